@@ -0,0 +1,135 @@
+package emulator
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/speaker"
+)
+
+//The buzzer is a tone generated while the sound timer is above 0, configurable from the config
+var buzzerFrequency float64 = 440
+var buzzerVolume float64 = 0.25 //Between 0 and 1
+var buzzerWaveform string = "square"
+var muted bool = false
+
+//audioSampleRate divides evenly into 60hz frames, so every frame is a whole number of samples
+var audioSampleRate int = 44100
+var samplesPerFrame int = audioSampleRate / 60
+
+//tone generates the buzzer's waveform, keeping its phase between frames so it doesn't click
+type tone struct {
+	phase float64
+}
+
+func (t *tone) next(on bool) float64 {
+	//Returns the next sample between -1 and 1, silence if the buzzer is off
+	var sample float64
+	if on {
+		if buzzerWaveform == "sine" {
+			sample = math.Sin(2*math.Pi*t.phase) * buzzerVolume
+		} else if t.phase < 0.5 {
+			sample = buzzerVolume
+		} else {
+			sample = -buzzerVolume
+		}
+	}
+
+	t.phase += buzzerFrequency / float64(audioSampleRate)
+	if t.phase >= 1 {
+		t.phase -= math.Floor(t.phase)
+	}
+	return sample
+}
+
+func (t *tone) frame(on bool) []int16 {
+	//A frame's worth of 16 bit samples
+	samples := make([]int16, samplesPerFrame)
+	for i := range samples {
+		samples[i] = int16(t.next(on) * math.MaxInt16)
+	}
+	return samples
+}
+
+//audioBackend plays the buzzer a frame at a time, it's told whether the buzzer is on at the end of every frame
+type audioBackend interface {
+	queueFrame(on bool)
+	close()
+}
+
+var audio audioBackend = nullAudio{}
+
+//nullAudio is used when there's no audio device, or audio is turned off in the config
+type nullAudio struct{}
+
+func (nullAudio) queueFrame(on bool) {}
+func (nullAudio) close()             {}
+
+//speakerAudio streams the buzzer to the speaker. Frames are queued as they're emulated and each one is played as exactly
+//samplesPerFrame samples, so the buzzer starts and stops on the same sample its frame does
+type speakerAudio struct {
+	frames    chan bool
+	tone      tone
+	on        bool
+	remaining int //Samples left in the frame being played
+}
+
+func (s *speakerAudio) Stream(samples [][2]float64) (int, bool) {
+	//Runs on the speaker's goroutine, it only ever hears from the emulator through the frames channel
+	for i := range samples {
+		if s.remaining == 0 {
+			select {
+			case s.on = <-s.frames:
+				s.remaining = samplesPerFrame
+			default:
+				//Nothing queued, the emulator is paused or running behind. Stay quiet and check again next sample
+				s.on = false
+				s.remaining = 1
+			}
+		}
+		sample := s.tone.next(s.on)
+		samples[i] = [2]float64{sample, sample}
+		s.remaining--
+	}
+	return len(samples), true
+}
+
+func (s *speakerAudio) Err() error {
+	return nil
+}
+
+func (s *speakerAudio) queueFrame(on bool) {
+	//Frames are dropped rather than waited on if the speaker falls behind
+	select {
+	case s.frames <- on && !muted:
+	default:
+	}
+}
+
+func (s *speakerAudio) close() {
+	speaker.Close()
+}
+
+func initAudio(backend string) audioBackend {
+	//Opens the speaker, falling back to no audio if there isn't a device to play on
+	if backend == "none" {
+		return nullAudio{}
+	}
+
+	sampleRate := beep.SampleRate(audioSampleRate)
+	if err := speaker.Init(sampleRate, sampleRate.N(time.Second/30)); err != nil {
+		fmt.Printf("no audio: %s\n", err)
+		return nullAudio{}
+	}
+
+	//A few frames of queue smooths over the emulator's uneven frame timing
+	s := &speakerAudio{frames: make(chan bool, 6)}
+	speaker.Play(s)
+	return s
+}
+
+func toggleMute() {
+	muted = !muted
+}
@@ -0,0 +1,79 @@
+package emulator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//breakpoints are addresses where running stops and stepmode is entered, they are kept across resets
+var breakpoints = make(map[uint16]bool)
+
+//watchpoints are addresses where running stops once the rom writes to them, watchpointHit is set by the write and
+//watchpointAddr is the address it wrote to
+var watchpoints = make(map[uint16]bool)
+var watchpointHit bool = false
+var watchpointAddr uint16
+
+func toggleBreakpoint(addr uint16) {
+	if breakpoints[addr] {
+		delete(breakpoints, addr)
+	} else {
+		breakpoints[addr] = true
+	}
+}
+
+func toggleWatchpoint(addr uint16) {
+	if watchpoints[addr] {
+		delete(watchpoints, addr)
+	} else {
+		watchpoints[addr] = true
+	}
+}
+
+func parseBreakpoints(list string) error {
+	//Adds breakpoints from a comma separated list of hex addresses such as 0x200,2A4
+	return parseAddressList(list, breakpoints)
+}
+
+func parseWatchpoints(list string) error {
+	return parseAddressList(list, watchpoints)
+}
+
+func parseAddressList(list string, addrs map[uint16]bool) error {
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		addr, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(field), "0x"), 16, 12)
+		if err != nil {
+			return fmt.Errorf("invalid address %q", field)
+		}
+		addrs[uint16(addr)] = true
+	}
+	return nil
+}
+
+func formatBreakpoints() string {
+	return formatAddressList(breakpoints)
+}
+
+func formatWatchpoints() string {
+	return formatAddressList(watchpoints)
+}
+
+func formatAddressList(list map[uint16]bool) string {
+	addrs := make([]int, 0)
+	for addr := range list {
+		addrs = append(addrs, int(addr))
+	}
+	sort.Ints(addrs)
+
+	formatted := make([]string, 0)
+	for _, addr := range addrs {
+		formatted = append(formatted, fmt.Sprintf("%03X", addr))
+	}
+	return strings.Join(formatted, " ")
+}
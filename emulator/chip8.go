@@ -3,7 +3,6 @@ package emulator
 import (
 	"fmt"
 	"github.com/veandco/go-sdl2/sdl"
-	"io/ioutil"
 	"math"
 	"math/rand"
 )
@@ -25,86 +24,140 @@ type CPU struct {
 	delayTimer uint8 //Delay timer
 	soundTimer uint8 //Sound timer
 
-	keyMap    map[int]int //dict of scancode:keyinput
-	keyInputs [16]bool    //key inputs
+	keyMap        map[sdl.Keycode]uint8 //dict of key:keyinput
+	controllerMap [2]map[string]uint8   //dict of controller input:keyinput for each player
+	deadzone      int16                 //How far a stick has to be pushed before it presses a key
+	keyInputs     [16]bool              //key inputs
+
+	romPath    string  //Path the rom was loaded from
+	romData    []uint8 //Rom as loaded, so it can be reset without reading the file again
+	rom        romInfo //What the database knows about the loaded rom
+	quirks     quirks  //Behaviour that differs between chip8 platforms
+	vblankWait bool    //Set by DRW when the vblank quirk is on, halts execution until the next frame
+
+	cycles    uint64       //Instructions executed since the rom started
+	lastWrite [4096]uint64 //Cycle each address was last written by the rom on, 0 if it never was
+
+	lastKey keyEvent //Most recent change to keyInputs, for the debugger
+	keyWait bool     //Set while Fx0A is waiting for a key, the pc stays on the Fx0A until one is pressed
+}
+
+//keyEvent is a keypad key going up or down and where it came from
+type keyEvent struct {
+	key     uint8
+	pressed bool
+	source  string //Keyboard key, controller input, keypad or touch
+	cycle   uint64 //Cycle the cpu was on at the time
 }
 
-func initCPU(rom string) *CPU {
+//quirks toggles the behaviours that differ between chip8 platforms, named after the chip-8-database quirks
+type quirks struct {
+	shift                 bool //8xy6 and 8xyE shift Vx in place instead of Vy
+	memoryIncrementByX    bool //Fx55 and Fx65 increase I by x instead of x+1
+	memoryLeaveIUnchanged bool //Fx55 and Fx65 leave I unchanged
+	wrap                  bool //Sprites wrap around the screen instead of being clipped
+	jump                  bool //Bnnn jumps to nnn + Vx instead of nnn + V0
+	vblank                bool //DRW waits for the next frame before the cpu continues
+	logic                 bool //8xy1, 8xy2 and 8xy3 reset VF
+}
+
+//defaultQuirks are the cowgod behaviours used for roms that aren't in the database
+var defaultQuirks = quirks{shift: true, memoryLeaveIUnchanged: true}
+
+func newCPU(rom string, data []uint8) *CPU {
 	cpu := new(CPU)
 	cpu.pc = 0x200
+	cpu.romPath = rom
+	cpu.romData = data
 	cpu.loadFonts()
-	cpu.loadRom(rom)
-
-	//map out scancodes to the keyinput value
-	cpu.keyMap = make(map[int]int)
-	cpu.keyMap[30] = 0x1
-	cpu.keyMap[31] = 0x2
-	cpu.keyMap[32] = 0x3
-	cpu.keyMap[33] = 0xC
-	cpu.keyMap[20] = 0x4
-	cpu.keyMap[26] = 0x5
-	cpu.keyMap[8] = 0x6
-	cpu.keyMap[21] = 0xD
-	cpu.keyMap[4] = 0x7
-	cpu.keyMap[22] = 0x8
-	cpu.keyMap[7] = 0x9
-	cpu.keyMap[9] = 0xE
-	cpu.keyMap[29] = 0xA
-	cpu.keyMap[27] = 0x0
-	cpu.keyMap[6] = 0xB
-	cpu.keyMap[25] = 0xF
+	cpu.loadRom(data)
+	cpu.rom = lookupRom(data)
+	cpu.quirks = cpu.rom.quirks
+
+	//map out keys and controller inputs to the keyinput value
+	conf := romSettings(rom, cpu.rom)
+	cpu.keyMap = buildKeyMap(conf)
+	cpu.controllerMap = buildControllerMap(conf, cpu.rom)
+	cpu.deadzone = deadzone(conf)
 
 	return cpu
 
 }
 
+//fontset holds the 4x5 sprites for the hex digits 0-F
+var fontset = []uint8{
+	0xF0, 0x90, 0x90, 0x90, 0xF0, // 0
+	0x20, 0x60, 0x20, 0x20, 0x70, // 1
+	0xF0, 0x10, 0xF0, 0x80, 0xF0, // 2
+	0xF0, 0x10, 0xF0, 0x10, 0xF0, // 3
+	0x90, 0x90, 0xF0, 0x10, 0x10, // 4
+	0xF0, 0x80, 0xF0, 0x10, 0xF0, // 5
+	0xF0, 0x80, 0xF0, 0x90, 0xF0, // 6
+	0xF0, 0x10, 0x20, 0x40, 0x40, // 7
+	0xF0, 0x90, 0xF0, 0x90, 0xF0, // 8
+	0xF0, 0x90, 0xF0, 0x10, 0xF0, // 9
+	0xF0, 0x90, 0xF0, 0x90, 0x90, // A
+	0xE0, 0x90, 0xE0, 0x90, 0xE0, // B
+	0xF0, 0x80, 0x80, 0x80, 0xF0, // C
+	0xE0, 0x90, 0x90, 0x90, 0xE0, // D
+	0xF0, 0x80, 0xF0, 0x80, 0xF0, // E
+	0xF0, 0x80, 0xF0, 0x80, 0x80, // F
+}
+
 func (c *CPU) loadFonts() {
 	//Loads in font data from 0x00
 
-	var fontset = []uint8{
-		0xF0, 0x90, 0x90, 0x90, 0xF0, // 0
-		0x20, 0x60, 0x20, 0x20, 0x70, // 1
-		0xF0, 0x10, 0xF0, 0x80, 0xF0, // 2
-		0xF0, 0x10, 0xF0, 0x10, 0xF0, // 3
-		0x90, 0x90, 0xF0, 0x10, 0x10, // 4
-		0xF0, 0x80, 0xF0, 0x10, 0xF0, // 5
-		0xF0, 0x80, 0xF0, 0x90, 0xF0, // 6
-		0xF0, 0x10, 0x20, 0x40, 0x40, // 7
-		0xF0, 0x90, 0xF0, 0x90, 0xF0, // 8
-		0xF0, 0x90, 0xF0, 0x10, 0xF0, // 9
-		0xF0, 0x90, 0xF0, 0x90, 0x90, // A
-		0xE0, 0x90, 0xE0, 0x90, 0xE0, // B
-		0xF0, 0x80, 0x80, 0x80, 0xF0, // C
-		0xE0, 0x90, 0x90, 0x90, 0xE0, // D
-		0xF0, 0x80, 0xF0, 0x80, 0xF0, // E
-		0xF0, 0x80, 0xF0, 0x80, 0x80, // F
-	}
-
 	for i := 0; i < len(fontset); i++ {
 		c.memory[i] = fontset[i]
 	}
 }
 
-func (c *CPU) loadRom(filePath string) {
-	//Loads rom into memory from 0x200
+func (c *CPU) loadRom(data []uint8) {
+	//Loads rom into memory from 0x200, anything that doesn't fit is cut off
 
-	fileData, readErr := ioutil.ReadFile(filePath)
-	if readErr != nil {
-		fmt.Println(readErr)
+	for i := 0; i < len(data) && 0x200+i < len(c.memory); i++ {
+		c.memory[0x200+i] = data[i]
 	}
 
-	for i := 0; i < len(fileData); i++ {
-		c.memory[0x200+i] = fileData[i]
+}
+
+func (c *CPU) writeMemory(addr uint16, value uint8) {
+	//Stores a byte for the rom, remembering when so the debugger can show recent writes. Addresses wrap at 4k
+	addr &= 0xFFF
+	noteHistoryWrite(addr, c.memory[addr], c.lastWrite[addr])
+	c.memory[addr] = value
+	c.lastWrite[addr] = c.cycles
+	coverage.write[addr]++
+	if watchpoints[addr] {
+		watchpointHit = true
+		watchpointAddr = addr
 	}
+}
 
+func (c *CPU) readMemory(addr uint16) uint8 {
+	//Loads a byte for the rom as data rather than as an instruction, counting it for the coverage report
+	addr &= 0xFFF
+	coverage.read[addr]++
+	return c.memory[addr]
 }
 
 func (c *CPU) cycle() (string, string, bool) {
 	//The fetch-decode-cycle for the system
-	c.opcode = uint16(c.memory[c.pc])<<8 | uint16(c.memory[c.pc+1])
+	pc := c.pc
+	c.opcode = c.opcodeAt(c.pc)
+	recordHistory(c)
+	coverage.exec[c.pc&0xFFF]++
+	if profiling != nil {
+		profiling.count(c)
+	}
 	c.pc += 2
+	c.cycles++
 
-	return c.decodeAndExecute()
+	memoryLocation, instruction, drawBool := c.decodeAndExecute()
+	//Skips, returns and Bnnn can go past the end of memory, the pc wraps like every other address
+	c.pc &= 0xFFF
+	stats.count(c, pc)
+	return memoryLocation, instruction, drawBool
 }
 
 func (c *CPU) decodeAndExecute() (string, string, bool) {
@@ -174,13 +227,13 @@ func (c *CPU) decodeAndExecute() (string, string, bool) {
 			c.SUBVxVy(x, y)
 			instruction = fmt.Sprintf("SUB V%X V%X", x, y)
 		case 0x6:
-			c.SHRVx(x)
+			c.SHRVx(x, y)
 			instruction = fmt.Sprintf("SHR V%X", x)
 		case 0x7:
 			c.SUBNVxVy(x, y)
 			instruction = fmt.Sprintf("SUBN V%X V%X", x, y)
 		case 0xE:
-			c.SHLVx(x)
+			c.SHLVx(x, y)
 			instruction = fmt.Sprintf("SHL V%X", x)
 		}
 	case 0x9:
@@ -243,9 +296,19 @@ func (c *CPU) decodeAndExecute() (string, string, bool) {
 
 }
 
-func (c *CPU) handleKeypress(scancode sdl.Scancode, keystate bool) {
-	//Use the keymap to correctly handle keydown and keyups
-	c.keyInputs[c.keyMap[int(scancode)]] = keystate
+func (c *CPU) handleKeypress(key sdl.Keycode, keystate bool) {
+	//Use the keymap to correctly handle keydown and keyups, ignoring keys that aren't mapped
+	if keyinput, ok := c.keyMap[key]; ok {
+		c.setKey(keyinput, keystate, sdl.GetKeyName(key))
+	}
+}
+
+func (c *CPU) setKey(key uint8, pressed bool, source string) {
+	//Presses or lets go of a keypad key, remembering it as the last key event if it changed
+	if c.keyInputs[key] != pressed {
+		c.lastKey = keyEvent{key, pressed, source, c.cycles}
+	}
+	c.keyInputs[key] = pressed
 }
 
 //The following functions are all the opcodes for the chip8 system
@@ -317,16 +380,25 @@ func (c *CPU) LDVxVy(x uint8, y uint8) {
 //ORVxVy 8xy1
 func (c *CPU) ORVxVy(x uint8, y uint8) {
 	c.V[x] |= c.V[y]
+	if c.quirks.logic {
+		c.V[0xF] = 0
+	}
 }
 
 //ANDVxVy 8xy2
 func (c *CPU) ANDVxVy(x uint8, y uint8) {
 	c.V[x] &= c.V[y]
+	if c.quirks.logic {
+		c.V[0xF] = 0
+	}
 }
 
 //XORVxVy 8xy3
 func (c *CPU) XORVxVy(x uint8, y uint8) {
 	c.V[x] ^= c.V[y]
+	if c.quirks.logic {
+		c.V[0xF] = 0
+	}
 }
 
 //ADDVxVy 8xy4
@@ -349,7 +421,10 @@ func (c *CPU) SUBVxVy(x uint8, y uint8) {
 }
 
 //SHRVx 8xy6
-func (c *CPU) SHRVx(x uint8) {
+func (c *CPU) SHRVx(x uint8, y uint8) {
+	if !c.quirks.shift {
+		c.V[x] = c.V[y]
+	}
 	c.V[0xF] = c.V[x] & 1
 	c.V[x] /= 2
 }
@@ -365,7 +440,10 @@ func (c *CPU) SUBNVxVy(x uint8, y uint8) {
 }
 
 //SHLVx 8xyE
-func (c *CPU) SHLVx(x uint8) {
+func (c *CPU) SHLVx(x uint8, y uint8) {
+	if !c.quirks.shift {
+		c.V[x] = c.V[y]
+	}
 
 	c.V[0xF] = (c.V[x] & 128) >> 7
 	c.V[x] *= 2
@@ -385,7 +463,11 @@ func (c *CPU) LDI(addr uint16) {
 
 //JPV Bnnn
 func (c *CPU) JPV(addr uint16) {
-	c.pc = addr + uint16(c.V[0])
+	if c.quirks.jump {
+		c.pc = (addr + uint16(c.V[(addr&0xF00)>>8])) & 0xFFF
+		return
+	}
+	c.pc = (addr + uint16(c.V[0])) & 0xFFF
 }
 
 //RNDVx Cxnn
@@ -401,13 +483,18 @@ func (c *CPU) DRW(x uint8, y uint8, n uint8) {
 	c.V[0xF] = 0
 
 	for y := uint16(0); y < uint16(n); y++ {
-		byteData := c.memory[c.index+y]
+		byteData := c.readMemory(c.index + y)
 		for x := 0; x < 8; x++ {
-			if xcoord < 64 && ycoord < 32 {
+			px, py := xcoord, ycoord
+			if c.quirks.wrap {
+				px %= 64
+				py %= 32
+			}
+			if px < 64 && py < 32 {
 				bitData := byteData & uint8(math.Pow(2, float64(7-x))) >> (7 - x)
-				c.display[ycoord][xcoord] ^= bitData
+				c.display[py][px] ^= bitData
 
-				if bitData == 1 && c.display[ycoord][xcoord] == 0 {
+				if bitData == 1 && c.display[py][px] == 0 {
 					c.V[0xF] = 1
 				}
 
@@ -417,6 +504,10 @@ func (c *CPU) DRW(x uint8, y uint8, n uint8) {
 		xcoord -= 8 //Sprites are eight by 8, and so the xcoord should be shifted accordingly for each line, kind of like a typewriter
 		ycoord++
 	}
+
+	if c.quirks.vblank {
+		c.vblankWait = true
+	}
 }
 
 //SKPVx Ex9E
@@ -450,6 +541,7 @@ func (c *CPU) LDVxK(x uint8) {
 	if !keypressed {
 		c.pc -= 2
 	}
+	c.keyWait = !keypressed
 }
 
 //LDDTVx Fx15
@@ -476,21 +568,35 @@ func (c *CPU) LDFVx(x uint8) {
 //LDBVx Fx33
 func (c *CPU) LDBVx(x uint8) {
 	value := c.V[x]
-	c.memory[c.index] = value / 100
-	c.memory[c.index+1] = (value / 10) % 10
-	c.memory[c.index+2] = value % 10
+	c.writeMemory(c.index, value/100)
+	c.writeMemory(c.index+1, (value/10)%10)
+	c.writeMemory(c.index+2, value%10)
 }
 
 //LDIVx Fx55
 func (c *CPU) LDIVx(x uint8) {
 	for i := uint16(0); i < uint16(x)+1; i++ {
-		c.memory[c.index+i] = c.V[i]
+		c.writeMemory(c.index+i, c.V[i])
 	}
+	c.incrementIndexAfterMemory(x)
 }
 
 //LDVxI Fx65
 func (c *CPU) LDVxI(x uint8) {
 	for i := uint16(0); i < uint16(x)+1; i++ {
-		c.V[i] = c.memory[c.index+i]
+		c.V[i] = c.readMemory(c.index + i)
+	}
+	c.incrementIndexAfterMemory(x)
+}
+
+func (c *CPU) incrementIndexAfterMemory(x uint8) {
+	//Fx55 and Fx65 move I past the registers they touched unless the platform says otherwise
+	if c.quirks.memoryLeaveIUnchanged {
+		return
+	}
+	if c.quirks.memoryIncrementByX {
+		c.index += uint16(x)
+	} else {
+		c.index += uint16(x) + 1
 	}
 }
@@ -0,0 +1,74 @@
+package emulator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+//config is read from gochip8.toml, everything in it is optional
+type config struct {
+	Layout          string                   `toml:"layout"`          //Keyboard layout the keypad is placed on
+	Keys            map[string]int           `toml:"keys"`            //Extra key name to chip8 key bindings
+	Hotkeys         map[string]string        `toml:"hotkeys"`         //Emulator action to key name bindings
+	Controller      controllerConfig         `toml:"controller"`      //Game controller bindings
+	Keypad          bool                     `toml:"keypad"`          //Show the on-screen keypad at start
+	Debugger        bool                     `toml:"debugger"`        //Open the termui debugger at start
+	History         *int                     `toml:"history"`         //Instructions kept for stepping backwards, 0 to turn it off
+	RomDir          string                   `toml:"romDir"`          //Directory the rom browser starts in
+	Palette         string                   `toml:"palette"`         //Name of the palette to start with
+	Palettes        map[string]paletteConfig `toml:"palettes"`        //Custom palettes by name
+	Scale           int32                    `toml:"scale"`           //Size of a chip8 pixel when the window opens
+	Border          *int32                   `toml:"border"`          //Width of the border around the display
+	Scaling         string                   `toml:"scaling"`         //integer or fit
+	Fullscreen      bool                     `toml:"fullscreen"`      //Start fullscreen
+	Present         string                   `toml:"present"`         //Presentation mode, immediate, frame, blend or phosphor
+	BlendFrames     int                      `toml:"blendFrames"`     //Frames averaged together in blend mode
+	PhosphorFrames  int                      `toml:"phosphorFrames"`  //Frames a pixel takes to fade out in phosphor mode
+	Filter          string                   `toml:"filter"`          //Post-processing filter, none, scanlines, grid, scale2x, scale3x or crt
+	ScreenshotScale int                      `toml:"screenshotScale"` //Size of screenshots as a multiple of 64x32
+	RecordFormat    string                   `toml:"recordFormat"`    //Format of recordings started with the hotkey, gif, y4m or rgb
+	Audio           string                   `toml:"audio"`           //Set to none to run without audio
+	Buzzer          buzzerConfig             `toml:"buzzer"`          //How the buzzer sounds
+	Roms            map[string]romConfig     `toml:"roms"`            //Per rom overrides, keyed by file name or sha1 hash
+}
+
+//buzzerConfig is the tone played while the sound timer is running
+type buzzerConfig struct {
+	Frequency float64  `toml:"frequency"` //In hz
+	Volume    *float64 `toml:"volume"`    //Between 0 and 1
+	Waveform  string   `toml:"waveform"`  //square or sine
+	Muted     bool     `toml:"muted"`
+}
+
+//romConfig overrides the global settings for a single rom
+type romConfig struct {
+	Layout     string           `toml:"layout"`
+	Keys       map[string]int   `toml:"keys"`
+	Controller controllerConfig `toml:"controller"`
+	Palette    string           `toml:"palette"`
+}
+
+var settings config
+
+func loadConfig(filePath string, required bool) {
+	//Reads the config file, a missing file is only an error if it was asked for explicitly
+	_, err := toml.DecodeFile(filePath, &settings)
+	if os.IsNotExist(err) && !required {
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func romSettings(filePath string, info romInfo) romConfig {
+	//Finds the overrides for a rom, matching on the sha1 hash first and then the file name
+	if conf, ok := settings.Roms[info.hash]; ok {
+		return conf
+	}
+	return settings.Roms[filepath.Base(filePath)]
+}
@@ -0,0 +1,203 @@
+package emulator
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+//controllerConfig binds controller inputs to chip8 keys for both players
+//Inputs are up, down, left and right for the d-pad and left stick, lookUp, lookDown, lookLeft and lookRight
+//for the right stick, and the SDL button names (a, b, x, y, start, leftshoulder...) for everything else
+type controllerConfig struct {
+	Deadzone int            `toml:"deadzone"`
+	Player1  map[string]int `toml:"player1"`
+	Player2  map[string]int `toml:"player2"`
+}
+
+//controller is a connected game controller and the player it controls
+type controller struct {
+	pad        *sdl.GameController
+	player     int
+	buttons    map[string]bool //Buttons held down, the d-pad as up, down, left and right
+	directions map[string]bool //Stick directions currently pushed past the deadzone
+}
+
+var defaultDeadzone = 8000
+
+//controllers holds the connected controllers by joystick instance id, at most one per player
+var controllers = make(map[sdl.JoystickID]*controller)
+
+//Database key names used to build a default mapping for each player
+var databaseDirections = [2]map[string]string{
+	{"up": "up", "down": "down", "left": "left", "right": "right", "a": "a", "b": "b"},
+	{"up": "player2Up", "down": "player2Down", "left": "player2Left", "right": "player2Right", "a": "player2A", "b": "player2B"},
+}
+
+func buildControllerMap(conf romConfig, info romInfo) [2]map[string]uint8 {
+	//Builds the mapping for each player from the rom database keys, then the config and finally the rom's own config
+	var controllerMap [2]map[string]uint8
+
+	for player := 0; player < 2; player++ {
+		controllerMap[player] = make(map[string]uint8)
+		for input, name := range databaseDirections[player] {
+			if key, ok := info.entry.Keys[name]; ok {
+				controllerMap[player][input] = uint8(key)
+			}
+		}
+	}
+
+	//Games without known keys mostly use 2, 4, 6 and 8 as directions and 5 as the action key
+	if len(controllerMap[0]) == 0 {
+		controllerMap[0] = map[string]uint8{"up": 0x2, "down": 0x8, "left": 0x4, "right": 0x6, "a": 0x5}
+	}
+
+	for _, c := range []controllerConfig{settings.Controller, conf.Controller} {
+		for player, bindings := range []map[string]int{c.Player1, c.Player2} {
+			for input, value := range bindings {
+				if value < 0 || value > 0xF {
+					fmt.Printf("controller input %q is bound to %X which isn't a chip8 key\n", input, value)
+					continue
+				}
+				controllerMap[player][input] = uint8(value)
+			}
+		}
+	}
+
+	return controllerMap
+}
+
+func deadzone(conf romConfig) int16 {
+	//The rom's own deadzone over the config's over the default, kept within how far a stick reports it can go
+	zone := defaultDeadzone
+	for _, c := range []controllerConfig{settings.Controller, conf.Controller} {
+		if c.Deadzone > 0 {
+			zone = c.Deadzone
+		}
+	}
+	if zone > math.MaxInt16 {
+		zone = math.MaxInt16
+	}
+	return int16(zone)
+}
+
+func (c *controller) press(held map[string]bool, input string, pressed bool) {
+	//Same as handleKeypress but for controller inputs. The d-pad and stick share inputs and several inputs can share a
+	//key, so a key is only let go once nothing on any controller holds it
+	held[input] = pressed
+	if key, ok := cpu.controllerMap[c.player][input]; ok {
+		cpu.setKey(key, pressed || controllerHolds(key), fmt.Sprintf("player %d %s", c.player+1, input))
+	}
+}
+
+func controllerHolds(key uint8) bool {
+	for _, c := range controllers {
+		for _, held := range []map[string]bool{c.buttons, c.directions} {
+			for input, down := range held {
+				if mapped, ok := cpu.controllerMap[c.player][input]; down && ok && mapped == key {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func freePlayer() int {
+	//Returns the first player without a controller, or -1 if both have one
+	taken := [2]bool{}
+	for _, c := range controllers {
+		taken[c.player] = true
+	}
+	for player := 0; player < 2; player++ {
+		if !taken[player] {
+			return player
+		}
+	}
+	return -1
+}
+
+func handleControllerEvent(event sdl.Event) {
+	//Handles controllers being plugged in and out as well as their buttons and sticks
+	switch e := event.(type) {
+	case *sdl.ControllerDeviceEvent:
+		if e.Type == sdl.CONTROLLERDEVICEADDED {
+			//Which is the device index when a controller is added. SDL announces it again if a mapping for it is added
+			//after it was plugged in, which mustn't give it to the other player as well
+			if _, ok := controllers[sdl.JoystickGetDeviceInstanceID(int(e.Which))]; ok {
+				return
+			}
+			player := freePlayer()
+			if player == -1 {
+				return
+			}
+			pad := sdl.GameControllerOpen(int(e.Which))
+			if pad == nil {
+				return
+			}
+			controllers[pad.Joystick().InstanceID()] = &controller{pad, player, make(map[string]bool), make(map[string]bool)}
+		} else if e.Type == sdl.CONTROLLERDEVICEREMOVED {
+			//And the instance id when it is removed
+			if c, ok := controllers[e.Which]; ok {
+				//Release anything that was held so keys don't get stuck down, unless the other controller holds them too
+				c.pad.Close()
+				delete(controllers, e.Which)
+				for _, held := range []map[string]bool{c.buttons, c.directions} {
+					for input, down := range held {
+						if down {
+							c.press(held, input, false)
+						}
+					}
+				}
+			}
+		}
+	case *sdl.ControllerButtonEvent:
+		c, ok := controllers[e.Which]
+		if !ok {
+			return
+		}
+		input := sdl.GameControllerGetStringForButton(sdl.GameControllerButton(e.Button))
+		switch sdl.GameControllerButton(e.Button) {
+		case sdl.CONTROLLER_BUTTON_DPAD_UP:
+			input = "up"
+		case sdl.CONTROLLER_BUTTON_DPAD_DOWN:
+			input = "down"
+		case sdl.CONTROLLER_BUTTON_DPAD_LEFT:
+			input = "left"
+		case sdl.CONTROLLER_BUTTON_DPAD_RIGHT:
+			input = "right"
+		}
+		c.press(c.buttons, input, e.State == sdl.PRESSED)
+	case *sdl.ControllerAxisEvent:
+		c, ok := controllers[e.Which]
+		if !ok {
+			return
+		}
+		switch sdl.GameControllerAxis(e.Axis) {
+		case sdl.CONTROLLER_AXIS_LEFTX:
+			c.moveStick("left", "right", e.Value)
+		case sdl.CONTROLLER_AXIS_LEFTY:
+			c.moveStick("up", "down", e.Value)
+		case sdl.CONTROLLER_AXIS_RIGHTX:
+			c.moveStick("lookLeft", "lookRight", e.Value)
+		case sdl.CONTROLLER_AXIS_RIGHTY:
+			c.moveStick("lookUp", "lookDown", e.Value)
+		}
+	}
+}
+
+func (c *controller) moveStick(negative string, positive string, value int16) {
+	//Presses the direction the stick is pushed past the deadzone, only sending changes so the d-pad isn't overridden
+	for _, direction := range []struct {
+		input   string
+		pressed bool
+	}{
+		{negative, value < -cpu.deadzone},
+		{positive, value > cpu.deadzone},
+	} {
+		if c.directions[direction.input] != direction.pressed {
+			c.press(c.directions, direction.input, direction.pressed)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+//go:build virtualjoystick
+
+package emulator
+
+import (
+	"testing"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+//Run with go test -tags virtualjoystick ./emulator/, it needs SDL 2.0.14 or later for virtual joysticks
+
+//virtualMapping lays a controller over the virtual joystick with button n as SDL's controller button n and the sticks on
+//the first four axes
+const virtualMapping = ",Virtual Controller,a:b0,b:b1,x:b2,y:b3,back:b4,guide:b5,start:b6,leftstick:b7,rightstick:b8," +
+	"leftshoulder:b9,rightshoulder:b10,dpup:b11,dpdown:b12,dpleft:b13,dpright:b14,leftx:a0,lefty:a1,rightx:a2,righty:a3,"
+
+func pumpControllerEvents() {
+	//Hands the controller events SDL has queued to the emulator, the way runWindow does
+	sdl.PumpEvents()
+	for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+		switch event.(type) {
+		case *sdl.ControllerDeviceEvent, *sdl.ControllerButtonEvent, *sdl.ControllerAxisEvent:
+			handleControllerEvent(event)
+		}
+	}
+}
+
+func TestVirtualControllers(t *testing.T) {
+	sdl.SetHint(sdl.HINT_JOYSTICK_ALLOW_BACKGROUND_EVENTS, "1")
+	if err := sdl.Init(sdl.INIT_GAMECONTROLLER | sdl.INIT_EVENTS); err != nil {
+		t.Skipf("no SDL game controller support: %s", err)
+	}
+	defer sdl.Quit()
+
+	//Player 1 uses the defaults for roms the database doesn't know, player 2 is bound in the config
+	saved := settings
+	defer func() { settings = saved }()
+	settings = config{Controller: controllerConfig{Deadzone: 10000, Player2: map[string]int{"up": 0xA, "down": 0xB, "a": 0xC}}}
+	cpu = newCPU("virtual", []uint8{0x12, 0x00})
+	controllers = make(map[sdl.JoystickID]*controller)
+
+	var pads [2]*virtualJoystick
+	for i := range pads {
+		pad, err := attachVirtualJoystick(4, 15)
+		if err != nil {
+			t.Skip(err)
+		}
+		defer pad.detach()
+		guid := sdl.JoystickGetGUIDString(sdl.JoystickGetDeviceGUID(pad.index))
+		if sdl.GameControllerAddMapping(guid+virtualMapping) < 0 {
+			t.Fatalf("couldn't add a mapping: %s", sdl.GetError())
+		}
+		pads[i] = pad
+	}
+	pumpControllerEvents()
+	if len(controllers) != 2 {
+		t.Fatalf("%d controllers were opened, want 2", len(controllers))
+	}
+
+	//Controllers go to players in the order SDL announces them
+	var players [2]*virtualJoystick
+	for _, pad := range pads {
+		c, ok := controllers[sdl.JoystickGetDeviceInstanceID(pad.index)]
+		if !ok {
+			t.Fatalf("virtual joystick %d wasn't opened as a controller", pad.index)
+		}
+		players[c.player] = pad
+	}
+
+	button := func(b sdl.GameControllerButton, pressed bool) func(*virtualJoystick) error {
+		return func(v *virtualJoystick) error { return v.setButton(int(b), pressed) }
+	}
+	axis := func(a sdl.GameControllerAxis, value int16) func(*virtualJoystick) error {
+		return func(v *virtualJoystick) error { return v.setAxis(int(a), value) }
+	}
+
+	tests := []struct {
+		name   string
+		player int
+		input  func(*virtualJoystick) error
+		held   []uint8 //Keys held afterwards, every other key must be up
+	}{
+		{"d-pad up", 0, button(sdl.CONTROLLER_BUTTON_DPAD_UP, true), []uint8{0x2}},
+		{"d-pad up released", 0, button(sdl.CONTROLLER_BUTTON_DPAD_UP, false), nil},
+		{"d-pad left", 0, button(sdl.CONTROLLER_BUTTON_DPAD_LEFT, true), []uint8{0x4}},
+		{"d-pad left released", 0, button(sdl.CONTROLLER_BUTTON_DPAD_LEFT, false), nil},
+		{"a", 0, button(sdl.CONTROLLER_BUTTON_A, true), []uint8{0x5}},
+		{"a released", 0, button(sdl.CONTROLLER_BUTTON_A, false), nil},
+		{"stick inside the deadzone", 0, axis(sdl.CONTROLLER_AXIS_LEFTX, 9000), nil},
+		{"stick right", 0, axis(sdl.CONTROLLER_AXIS_LEFTX, 20000), []uint8{0x6}},
+		{"stick across to the left", 0, axis(sdl.CONTROLLER_AXIS_LEFTX, -20000), []uint8{0x4}},
+		{"stick centred", 0, axis(sdl.CONTROLLER_AXIS_LEFTX, 0), nil},
+		{"stick down inside the deadzone", 0, axis(sdl.CONTROLLER_AXIS_LEFTY, 9999), nil},
+		{"stick down", 0, axis(sdl.CONTROLLER_AXIS_LEFTY, 10001), []uint8{0x8}},
+		{"stick down released", 0, axis(sdl.CONTROLLER_AXIS_LEFTY, 0), nil},
+		{"d-pad up with the stick", 0, button(sdl.CONTROLLER_BUTTON_DPAD_UP, true), []uint8{0x2}},
+		{"stick up with the d-pad", 0, axis(sdl.CONTROLLER_AXIS_LEFTY, -20000), []uint8{0x2}},
+		{"d-pad up released with the stick still up", 0, button(sdl.CONTROLLER_BUTTON_DPAD_UP, false), []uint8{0x2}},
+		{"stick up released", 0, axis(sdl.CONTROLLER_AXIS_LEFTY, 0), nil},
+		{"player 2 d-pad up", 1, button(sdl.CONTROLLER_BUTTON_DPAD_UP, true), []uint8{0xA}},
+		{"player 2 d-pad up released", 1, button(sdl.CONTROLLER_BUTTON_DPAD_UP, false), nil},
+		{"player 2 a", 1, button(sdl.CONTROLLER_BUTTON_A, true), []uint8{0xC}},
+		{"player 2 a released", 1, button(sdl.CONTROLLER_BUTTON_A, false), nil},
+		{"player 2 stick inside the deadzone", 1, axis(sdl.CONTROLLER_AXIS_LEFTY, 5000), nil},
+		{"player 2 stick down", 1, axis(sdl.CONTROLLER_AXIS_LEFTY, 30000), []uint8{0xB}},
+		{"player 2 stick up", 1, axis(sdl.CONTROLLER_AXIS_LEFTY, -30000), []uint8{0xA}},
+		{"player 2 stick centred", 1, axis(sdl.CONTROLLER_AXIS_LEFTY, 0), nil},
+		{"player 2 b is unbound", 1, button(sdl.CONTROLLER_BUTTON_B, true), nil},
+	}
+	for _, tt := range tests {
+		if err := tt.input(players[tt.player]); err != nil {
+			t.Fatal(err)
+		}
+		pumpControllerEvents()
+
+		var want [16]bool
+		for _, key := range tt.held {
+			want[key] = true
+		}
+		if cpu.keyInputs != want {
+			t.Errorf("%s: keys held %v, want %v", tt.name, cpu.keyInputs, want)
+		}
+	}
+}
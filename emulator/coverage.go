@@ -0,0 +1,235 @@
+package emulator
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//coverageCounts is how many times each address was run as an instruction, read as data and written by the rom
+type coverageCounts struct {
+	exec  [4096]uint64
+	read  [4096]uint64
+	write [4096]uint64
+}
+
+//coverage is counted from when the rom starts, through resets, so a whole session can be reported
+var coverage coverageCounts
+
+//coveragePath is where the report asked for with -coverage is written on exit
+var coveragePath string
+
+//symbols names addresses in the rom, loaded with -symbols. Labels are used in the coverage report and the profiler
+var symbols = make(map[uint16]string)
+
+func resetCoverage() {
+	coverage = coverageCounts{}
+}
+
+func (c *coverageCounts) executed(addr uint16) bool {
+	//Either byte of an instruction that ran counts as executed
+	return c.exec[addr] > 0 || (addr > 0 && c.exec[addr-1] > 0)
+}
+
+func loadSymbols(path string) error {
+	//Reads a symbol map with a label and a hex address on each line, in either order, like "draw 0x2A4" or "2A4 = draw"
+	//Blank lines and anything after # or ; are skipped
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#;"); i != -1 {
+			line = line[:i]
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == '=' || r == ':' || r == ','
+		})
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: expected a label and an address", path, lineNumber)
+		}
+
+		if addr, ok := parseSymbolAddress(fields[1]); ok {
+			symbols[addr] = fields[0]
+		} else if addr, ok := parseSymbolAddress(fields[0]); ok {
+			symbols[addr] = fields[1]
+		} else {
+			return fmt.Errorf("%s:%d: no address below 0x1000 in %q", path, lineNumber, line)
+		}
+	}
+	return scanner.Err()
+}
+
+func parseSymbolAddress(field string) (uint16, bool) {
+	for _, prefix := range []string{"0x", "0X", "$", "#"} {
+		field = strings.TrimPrefix(field, prefix)
+	}
+	addr, err := strconv.ParseUint(field, 16, 16)
+	if err != nil || addr >= 0x1000 {
+		return 0, false
+	}
+	return uint16(addr), true
+}
+
+//coverageLabel is the stretch of memory from one label to the next
+type coverageLabel struct {
+	name       string
+	start, end uint16 //Inclusive
+}
+
+func coverageLabels(romEnd uint16) []coverageLabel {
+	//Each label runs until the next one, the last one until the end of the rom, and none past the end of memory
+	if romEnd > 0xFFF {
+		romEnd = 0xFFF
+	}
+	addrs := make([]int, 0, len(symbols))
+	for addr := range symbols {
+		addrs = append(addrs, int(addr))
+	}
+	sort.Ints(addrs)
+
+	labels := make([]coverageLabel, 0, len(addrs))
+	for i, addr := range addrs {
+		end := romEnd
+		if i+1 < len(addrs) {
+			end = uint16(addrs[i+1] - 1)
+		} else if uint16(addr) > romEnd {
+			end = 0xFFF
+		}
+		labels = append(labels, coverageLabel{symbols[uint16(addr)], uint16(addr), end})
+	}
+	return labels
+}
+
+//addressRange is a run of addresses, inclusive
+type addressRange struct {
+	start, end uint16
+}
+
+func (r addressRange) String() string {
+	if r.start == r.end {
+		return fmt.Sprintf("%03X", r.start)
+	}
+	return fmt.Sprintf("%03X-%03X", r.start, r.end)
+}
+
+func addressRanges(from uint16, to uint16, test func(uint16) bool) []addressRange {
+	//Finds the runs of addresses that pass the test
+	ranges := make([]addressRange, 0)
+	for addr := int(from); addr <= int(to); addr++ {
+		if !test(uint16(addr)) {
+			continue
+		}
+		start := addr
+		for addr+1 <= int(to) && test(uint16(addr+1)) {
+			addr++
+		}
+		ranges = append(ranges, addressRange{uint16(start), uint16(addr)})
+	}
+	return ranges
+}
+
+func writeCoverage(path string) error {
+	//Writes the coverage of the rom as text, by label when there's a symbol map and as address ranges either way
+	var report strings.Builder
+
+	//A rom too big for memory only has the part that was loaded counted
+	romStart, romEnd := uint16(0x200), uint16(0xFFF)
+	if len(cpu.romData) == 0 {
+		romEnd = romStart
+	} else if end := 0x200 + len(cpu.romData) - 1; end < 0xFFF {
+		romEnd = uint16(end)
+	}
+	executedBytes, readBytes, writtenBytes := 0, 0, 0
+	for addr := romStart; addr <= romEnd; addr++ {
+		if coverage.executed(addr) {
+			executedBytes++
+		}
+	}
+	for addr := 0; addr < 0x1000; addr++ {
+		if coverage.read[addr] > 0 {
+			readBytes++
+		}
+		if coverage.write[addr] > 0 {
+			writtenBytes++
+		}
+	}
+
+	title := cpu.romPath
+	if cpu.rom.known {
+		title = cpu.rom.program.Title
+	}
+	romBytes := int(romEnd-romStart) + 1
+	fmt.Fprintf(&report, "Coverage of %s\n", title)
+	fmt.Fprintf(&report, "Rom %03X-%03X, %d bytes: %d executed (%.1f%%)\n", romStart, romEnd, romBytes,
+		executedBytes, float64(executedBytes)*100/float64(romBytes))
+	fmt.Fprintf(&report, "Memory: %d bytes read as data, %d bytes written\n", readBytes, writtenBytes)
+
+	if len(symbols) > 0 {
+		fmt.Fprintf(&report, "\n%-24s %-5s %-5s %6s %9s %12s %10s %10s\n", "label", "start", "end", "bytes", "executed", "instructions", "reads", "writes")
+		for _, label := range coverageLabels(romEnd) {
+			bytes, executed := 0, 0
+			var instructions, reads, writes uint64
+			for addr := int(label.start); addr <= int(label.end); addr++ {
+				bytes++
+				if coverage.executed(uint16(addr)) {
+					executed++
+				}
+				instructions += coverage.exec[addr]
+				reads += coverage.read[addr]
+				writes += coverage.write[addr]
+			}
+			fmt.Fprintf(&report, "%-24s %03X   %03X   %6d %8.1f%% %12d %10d %10d\n", label.name, label.start, label.end,
+				bytes, float64(executed)*100/float64(bytes), instructions, reads, writes)
+		}
+	}
+
+	sections := []struct {
+		title    string
+		from, to uint16
+		test     func(uint16) bool
+	}{
+		{"Executed", 0, 0xFFF, coverage.executed},
+		{"Never executed in the rom", romStart, romEnd, func(addr uint16) bool { return !coverage.executed(addr) }},
+		{"Read as data", 0, 0xFFF, func(addr uint16) bool { return coverage.read[addr] > 0 }},
+		{"Written", 0, 0xFFF, func(addr uint16) bool { return coverage.write[addr] > 0 }},
+	}
+	for _, section := range sections {
+		fmt.Fprintf(&report, "\n%s\n", section.title)
+		ranges := addressRanges(section.from, section.to, section.test)
+		if len(ranges) == 0 {
+			report.WriteString("  none\n")
+		}
+		for _, r := range ranges {
+			label := ""
+			if name, ok := symbols[r.start]; ok {
+				label = " " + name
+			}
+			fmt.Fprintf(&report, "  %s%s\n", r, label)
+		}
+	}
+
+	return ioutil.WriteFile(path, []byte(report.String()), 0644)
+}
+
+func saveCoverage() {
+	//Deferred by RunEmulator like the other captures, so errors show once the terminal is back
+	if coveragePath == "" || cpu == nil {
+		return
+	}
+	if err := writeCoverage(coveragePath); err != nil {
+		fmt.Printf("couldn't write coverage: %s\n", err)
+	}
+	coveragePath = ""
+}
@@ -0,0 +1,915 @@
+package emulator
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//The debug adapter lets editors like VS Code debug roms over the Debug Adapter Protocol. The rom runs without a window,
+//with a single thread whose stack frames are the chip8 stack. Messages are JSON with a Content-Length header, as in LSP
+
+//dapRequest is a message from the editor, the only kind it sends
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapResponse struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+type dapSource struct {
+	Name            string `json:"name"`
+	Path            string `json:"path,omitempty"`
+	SourceReference int    `json:"sourceReference,omitempty"`
+}
+
+type dapBreakpoint struct {
+	Verified             bool   `json:"verified"`
+	Message              string `json:"message,omitempty"`
+	Line                 int    `json:"line,omitempty"`
+	InstructionReference string `json:"instructionReference,omitempty"`
+}
+
+type dapStackFrame struct {
+	ID                          int        `json:"id"`
+	Name                        string     `json:"name"`
+	Source                      *dapSource `json:"source,omitempty"`
+	Line                        int        `json:"line"`
+	Column                      int        `json:"column"`
+	InstructionPointerReference string     `json:"instructionPointerReference"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+	MemoryReference    string `json:"memoryReference,omitempty"`
+}
+
+type dapInstruction struct {
+	Address          string     `json:"address"`
+	InstructionBytes string     `json:"instructionBytes,omitempty"`
+	Instruction      string     `json:"instruction"`
+	Symbol           string     `json:"symbol,omitempty"`
+	Location         *dapSource `json:"location,omitempty"`
+	Line             int        `json:"line,omitempty"`
+	PresentationHint string     `json:"presentationHint,omitempty"`
+}
+
+//Variable references for the scopes, every frame shares them since there's only the one machine
+const (
+	dapRegisters = 1
+	dapMemory    = 2
+	dapKeys      = 3
+	dapDisplay   = 4
+)
+
+//dapListingReference is the sourceReference of the disassembly of the rom, one instruction to a line from 0x200
+const dapListingReference = 1
+
+//dapSession is one editor connected to the adapter
+type dapSession struct {
+	in    *bufio.Reader
+	out   io.Writer
+	seq   int
+	write sync.Mutex //Responses come from the request loop and stops from the run loop
+
+	//lock guards the cpu and everything below, the run loop holds it for a frame at a time
+	lock       sync.Mutex
+	launched   bool
+	running    bool
+	generation int //Bumped whenever running stops or starts, so an old run loop knows to finish
+	entry      bool
+
+	source      string         //Source file the line map belongs to
+	lineAddrs   map[int]uint16 //Source line to the address of its first instruction
+	addrLines   map[uint16]int
+	sourceBreak map[string][]uint16 //Breakpoints set on each source, by path or the listing's name
+	addrBreak   []uint16            //Breakpoints set on instructions in the disassembly view
+
+	after []func() //Sent once the response to the current request is
+}
+
+func runDAP(args []string) error {
+	//gochip8 dap talks to the editor on stdin and stdout, -listen takes connections on a port one after another instead
+	flags := flag.NewFlagSet("dap", flag.ExitOnError)
+	listen := flags.String("listen", "", "address to listen on for the editor, like :4711, instead of stdin and stdout")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gochip8 dap [-listen address]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *listen == "" {
+		return newDAPSession(os.Stdin, os.Stdout).serve()
+	}
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	fmt.Fprintf(os.Stderr, "debug adapter listening on %s\n", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		if err := newDAPSession(conn, conn).serve(); err != nil {
+			fmt.Fprintf(os.Stderr, "debug session ended: %s\n", err)
+		}
+		conn.Close()
+	}
+}
+
+func newDAPSession(in io.Reader, out io.Writer) *dapSession {
+	return &dapSession{in: bufio.NewReader(in), out: out, sourceBreak: make(map[string][]uint16)}
+}
+
+func readDAPMessage(r *bufio.Reader) ([]byte, error) {
+	//Headers end at a blank line, Content-Length is the only one that matters
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if length >= 0 {
+				break
+			}
+			continue
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("bad Content-Length %q", value)
+			}
+		}
+	}
+	body := make([]byte, length)
+	_, err := io.ReadFull(r, body)
+	return body, err
+}
+
+func (s *dapSession) send(message func(seq int) interface{}) {
+	s.write.Lock()
+	defer s.write.Unlock()
+	s.seq++
+	data, err := json.Marshal(message(s.seq))
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n", len(data))
+	s.out.Write(data)
+}
+
+func (s *dapSession) event(name string, body interface{}) {
+	s.send(func(seq int) interface{} {
+		return dapEvent{Seq: seq, Type: "event", Event: name, Body: body}
+	})
+}
+
+func (s *dapSession) stopped(reason string, text string) {
+	//text says more about why, shown by the editor next to the reason
+	body := map[string]interface{}{"reason": reason, "threadId": 1, "allThreadsStopped": true}
+	if text != "" {
+		body["description"], body["text"] = text, text
+	}
+	s.event("stopped", body)
+}
+
+func (s *dapSession) serve() error {
+	//Handles requests until the editor disconnects, leaving the rom stopped
+	defer func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.halt()
+	}()
+
+	for {
+		data, err := readDAPMessage(s.in)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		var request dapRequest
+		if err := json.Unmarshal(data, &request); err != nil {
+			return fmt.Errorf("bad message: %s", err)
+		}
+
+		body, after, err := s.handleLocked(request)
+
+		s.send(func(seq int) interface{} {
+			response := dapResponse{Seq: seq, Type: "response", RequestSeq: request.Seq, Success: err == nil,
+				Command: request.Command, Body: body}
+			if err != nil {
+				response.Message = err.Error()
+			}
+			return response
+		})
+		for _, f := range after {
+			f()
+		}
+		if request.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+func (s *dapSession) handleLocked(request dapRequest) (body interface{}, after []func(), err error) {
+	//A request that crashes the emulator fails and leaves the rom stopped, rather than taking the lock down with it
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	defer func() {
+		if r := recover(); r != nil {
+			s.halt()
+			body, after, err = nil, nil, fmt.Errorf("%s crashed the emulator: %v", request.Command, r)
+		}
+	}()
+
+	body, err = s.handle(request)
+	after, s.after = s.after, nil
+	return body, after, err
+}
+
+func (s *dapSession) handle(request dapRequest) (interface{}, error) {
+	//Runs a request with the lock held, events that have to follow the response are added to s.after
+	var args struct {
+		//Launch
+		Program     string `json:"program"`
+		StopOnEntry bool   `json:"stopOnEntry"`
+		Symbols     string `json:"symbols"`
+		LineMap     string `json:"lineMap"`
+		Speed       int    `json:"speed"`
+
+		//Breakpoints
+		Source      dapSource `json:"source"`
+		Breakpoints []struct {
+			Line                 int    `json:"line"`
+			InstructionReference string `json:"instructionReference"`
+			Offset               int    `json:"offset"`
+		} `json:"breakpoints"`
+
+		//Variables and memory
+		VariablesReference int    `json:"variablesReference"`
+		Name               string `json:"name"`
+		Value              string `json:"value"`
+		MemoryReference    string `json:"memoryReference"`
+		Offset             int    `json:"offset"`
+		Count              int    `json:"count"`
+		InstructionOffset  int    `json:"instructionOffset"`
+		InstructionCount   int    `json:"instructionCount"`
+		SourceReference    int    `json:"sourceReference"`
+	}
+	if len(request.Arguments) > 0 {
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, fmt.Errorf("bad arguments: %s", err)
+		}
+	}
+
+	//Everything but setting up and tearing down needs a rom
+	switch request.Command {
+	case "initialize", "launch", "threads", "scopes", "terminate", "disconnect":
+	default:
+		if !s.launched {
+			return nil, fmt.Errorf("no rom has been launched")
+		}
+	}
+
+	switch request.Command {
+	case "initialize":
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsDisassembleRequest":       true,
+			"supportsInstructionBreakpoints":   true,
+			"supportsReadMemoryRequest":        true,
+			"supportsSetVariable":              true,
+			"supportsStepBack":                 historyLength > 0,
+			"supportsSteppingGranularity":      true,
+			"supportsTerminateRequest":         true,
+		}, nil
+
+	case "launch":
+		if err := s.launch(args.Program, args.Symbols, args.LineMap, args.Speed); err != nil {
+			return nil, err
+		}
+		s.entry = args.StopOnEntry
+		s.after = append(s.after, func() { s.event("initialized", nil) })
+		return nil, nil
+
+	case "configurationDone":
+		if s.entry {
+			s.after = append(s.after, func() { s.stopped("entry", "") })
+		} else {
+			//Nothing has run yet, so a breakpoint on the first instruction stops it
+			s.resume(nil)
+			resumed = false
+		}
+		return nil, nil
+
+	case "setBreakpoints":
+		lines := make([]int, 0)
+		for _, b := range args.Breakpoints {
+			lines = append(lines, b.Line)
+		}
+		return map[string]interface{}{"breakpoints": s.setSourceBreakpoints(args.Source, lines)}, nil
+
+	case "setInstructionBreakpoints":
+		s.addrBreak = s.addrBreak[:0]
+		result := make([]dapBreakpoint, 0)
+		for _, b := range args.Breakpoints {
+			addr, ok := parseSymbolAddress(b.InstructionReference)
+			if !ok || int(addr)+b.Offset < 0 || int(addr)+b.Offset >= 0x1000 {
+				result = append(result, dapBreakpoint{Message: fmt.Sprintf("no address %q", b.InstructionReference)})
+				continue
+			}
+			addr = uint16(int(addr) + b.Offset)
+			s.addrBreak = append(s.addrBreak, addr)
+			result = append(result, dapBreakpoint{Verified: true, Line: s.line(addr), InstructionReference: dapAddress(addr)})
+		}
+		s.rebuildBreakpoints()
+		return map[string]interface{}{"breakpoints": result}, nil
+
+	case "threads":
+		return map[string]interface{}{"threads": []map[string]interface{}{{"id": 1, "name": "chip8"}}}, nil
+
+	case "stackTrace":
+		frames := s.stackFrames()
+		return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+
+	case "scopes":
+		return map[string]interface{}{"scopes": []map[string]interface{}{
+			{"name": "Registers", "variablesReference": dapRegisters, "expensive": false, "presentationHint": "registers"},
+			{"name": "Memory", "variablesReference": dapMemory, "expensive": true},
+			{"name": "Keys", "variablesReference": dapKeys, "expensive": false},
+			{"name": "Display", "variablesReference": dapDisplay, "expensive": true},
+		}}, nil
+
+	case "variables":
+		return map[string]interface{}{"variables": dapVariables(args.VariablesReference)}, nil
+
+	case "setVariable":
+		if s.running {
+			return nil, fmt.Errorf("pause the rom to change it")
+		}
+		value, err := dapSetVariable(args.VariablesReference, args.Name, args.Value)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"value": value}, nil
+
+	case "readMemory":
+		addr, ok := parseSymbolAddress(args.MemoryReference)
+		if !ok {
+			return nil, fmt.Errorf("no address %q", args.MemoryReference)
+		}
+		//Only what's in memory is read, so a range starting below 0 gives the part from 0 on and the address moves up to it
+		count := dapClamp(args.Count, 0x1000)
+		start, end := int(addr)+args.Offset, int(addr)+args.Offset+count
+		first, last := start, end
+		if first < 0 {
+			first = 0
+		}
+		if last > 0x1000 {
+			last = 0x1000
+		}
+		data := make([]byte, 0, count)
+		if first < last {
+			data = append(data, cpu.memory[first:last]...)
+		}
+		unreadable := end - first - len(data)
+		if unreadable < 0 {
+			unreadable = 0
+		}
+		return map[string]interface{}{"address": dapAddress(uint16(first)), "data": base64.StdEncoding.EncodeToString(data),
+			"unreadableBytes": unreadable}, nil
+
+	case "disassemble":
+		addr, ok := parseSymbolAddress(args.MemoryReference)
+		if !ok {
+			return nil, fmt.Errorf("no address %q", args.MemoryReference)
+		}
+		return map[string]interface{}{"instructions": s.disassembly(int(addr)+args.Offset+args.InstructionOffset*2,
+			dapClamp(args.InstructionCount, 0x800))}, nil
+
+	case "source":
+		if args.SourceReference != dapListingReference && args.Source.SourceReference != dapListingReference {
+			return nil, fmt.Errorf("unknown source")
+		}
+		return map[string]interface{}{"content": dapListing()}, nil
+
+	case "continue":
+		s.resume(nil)
+		return map[string]interface{}{"allThreadsContinued": true}, nil
+
+	case "pause":
+		if s.running {
+			s.halt()
+			s.after = append(s.after, func() { s.stopped("pause", "") })
+		}
+		return nil, nil
+
+	case "next":
+		//Steps over calls by running until the subroutine returns
+		if cpu.opcodeAt(cpu.pc)>>12 == 0x2 && cpu.stkptr < 16 {
+			depth, ret := cpu.stkptr, cpu.pc+2
+			s.resume(func() bool { return cpu.stkptr == depth && cpu.pc == ret })
+		} else {
+			s.step()
+		}
+		return nil, nil
+
+	case "stepIn":
+		s.step()
+		return nil, nil
+
+	case "stepOut":
+		if cpu.stkptr == 0 {
+			s.step()
+		} else {
+			depth := cpu.stkptr
+			s.resume(func() bool { return cpu.stkptr < depth })
+		}
+		return nil, nil
+
+	case "stepBack":
+		s.halt()
+		if !undoInstruction() {
+			return nil, fmt.Errorf("no history to go back through")
+		}
+		s.after = append(s.after, func() { s.stopped("step", "") })
+		return nil, nil
+
+	case "reverseContinue":
+		//Stops at a breakpoint, after a write to a watchpoint or at the start of history, saying which
+		s.halt()
+		if len(historyDeltas) == 0 {
+			return nil, fmt.Errorf("no history to go back through")
+		}
+		message := reverseContinue()
+		reason := "step"
+		if breakpoints[cpu.pc] {
+			reason = "breakpoint"
+		} else if len(historyDeltas) > 0 {
+			reason = "data breakpoint"
+		}
+		s.after = append(s.after, func() { s.stopped(reason, message) })
+		return nil, nil
+
+	case "terminate":
+		s.halt()
+		s.after = append(s.after, func() { s.event("terminated", nil) })
+		return nil, nil
+
+	case "disconnect":
+		s.halt()
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%s isn't supported", request.Command)
+}
+
+func (s *dapSession) launch(program string, symbolsPath string, lineMapPath string, romSpeed int) error {
+	//Loads the rom into a fresh cpu, which waits for configurationDone before running
+	if program == "" {
+		return fmt.Errorf("launch needs the program to debug")
+	}
+	data, err := ioutil.ReadFile(program)
+	if err != nil {
+		return err
+	}
+
+	//Nothing carries over from an earlier launch or an earlier session on the same port, the editor sends its
+	//breakpoints again once it's told the rom is initialized
+	symbols = make(map[uint16]string)
+	s.source, s.lineAddrs, s.addrLines = "", nil, nil
+	s.sourceBreak, s.addrBreak = make(map[string][]uint16), nil
+	s.rebuildBreakpoints()
+	if symbolsPath != "" {
+		if err := loadSymbols(symbolsPath); err != nil {
+			return err
+		}
+	}
+	if lineMapPath != "" {
+		if err := s.loadLineMap(lineMapPath); err != nil {
+			return err
+		}
+	}
+
+	s.halt()
+	cpu = newCPU(program, data)
+	speedGiven = romSpeed > 0
+	if speedGiven {
+		speed = romSpeed
+	}
+	setRomSpeed()
+	resetCoverage()
+	resetStats()
+	clearHistory()
+	s.launched = true
+	return nil
+}
+
+func (s *dapSession) loadLineMap(path string) error {
+	//A line map ties a source file to the rom, "source: path" names the file and each other line is a line number then the
+	//hex address its code was assembled to, with the same separators and comments as a symbol map
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s.lineAddrs, s.addrLines = make(map[int]uint16), make(map[uint16]int)
+	for lineNumber, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexAny(line, "#;"); i != -1 {
+			line = line[:i]
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(name) == "source" {
+			s.source = strings.TrimSpace(value)
+			if !filepath.IsAbs(s.source) {
+				s.source = filepath.Join(filepath.Dir(path), s.source)
+			}
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == '=' || r == ':' || r == ','
+		})
+		if len(fields) == 0 {
+			continue
+		}
+		sourceLine, err := strconv.Atoi(fields[0])
+		addr, ok := uint16(0), false
+		if len(fields) == 2 {
+			addr, ok = parseSymbolAddress(fields[1])
+		}
+		if err != nil || !ok {
+			return fmt.Errorf("%s:%d: expected a line number and an address", path, lineNumber+1)
+		}
+		s.lineAddrs[sourceLine] = addr
+		if _, ok := s.addrLines[addr]; !ok {
+			s.addrLines[addr] = sourceLine
+		}
+	}
+	if s.source == "" {
+		return fmt.Errorf("%s: no source: line naming the file", path)
+	}
+	return nil
+}
+
+func dapClamp(count int, most int) int {
+	//Counts from the editor are kept to what memory can hold, so a bad one can't ask for a huge or negative allocation
+	if count < 0 {
+		return 0
+	} else if count > most {
+		return most
+	}
+	return count
+}
+
+func dapAddress(addr uint16) string {
+	return fmt.Sprintf("0x%03X", addr)
+}
+
+func (s *dapSession) listingSource() *dapSource {
+	return &dapSource{Name: filepath.Base(cpu.romPath) + " (disassembly)", SourceReference: dapListingReference}
+}
+
+func dapListing() string {
+	//The rom disassembled two bytes to a line from 0x200, so line n is address 0x200+2(n-1) whatever the rom's alignment
+	var listing strings.Builder
+	for addr := 0x200; addr < 0x200+len(cpu.romData); addr += 2 {
+		line := fmt.Sprintf("%03X  %04X  %s", addr, cpu.opcodeAt(uint16(addr)), disassemble(cpu.opcodeAt(uint16(addr))))
+		if label, ok := symbols[uint16(addr)]; ok {
+			line = fmt.Sprintf("%-30s ; %s", line, label)
+		}
+		listing.WriteString(line + "\n")
+	}
+	return listing.String()
+}
+
+func (s *dapSession) line(addr uint16) int {
+	//Where an address is in the source if there's a line map, otherwise in the listing, 0 if it's in neither
+	if s.addrLines != nil {
+		return s.addrLines[addr]
+	}
+	if addr < 0x200 || int(addr) >= 0x200+len(cpu.romData) {
+		return 0
+	}
+	return int(addr-0x200)/2 + 1
+}
+
+func (s *dapSession) setSourceBreakpoints(source dapSource, lines []int) []dapBreakpoint {
+	//Breakpoints by line go on the listing, or on the source file when it's the one the line map is for. A line without
+	//code moves down to the next one that has some
+	key := source.Path
+	if source.SourceReference == dapListingReference || key == "" {
+		key = "listing"
+	}
+	s.sourceBreak[key] = nil
+
+	result := make([]dapBreakpoint, 0)
+	for _, line := range lines {
+		addr, found := uint16(0), false
+		if key == "listing" {
+			if line > 0 && 0x200+(line-1)*2 < 0x200+len(cpu.romData) {
+				addr, found = uint16(0x200+(line-1)*2), true
+			}
+		} else if s.lineAddrs != nil && filepath.Clean(source.Path) == filepath.Clean(s.source) {
+			mapped := make([]int, 0, len(s.lineAddrs))
+			for l := range s.lineAddrs {
+				mapped = append(mapped, l)
+			}
+			sort.Ints(mapped)
+			if i := sort.SearchInts(mapped, line); i < len(mapped) {
+				line, addr, found = mapped[i], s.lineAddrs[mapped[i]], true
+			}
+		}
+
+		if !found {
+			result = append(result, dapBreakpoint{Line: line, Message: "no code at this line"})
+			continue
+		}
+		s.sourceBreak[key] = append(s.sourceBreak[key], addr)
+		result = append(result, dapBreakpoint{Verified: true, Line: line, InstructionReference: dapAddress(addr)})
+	}
+	s.rebuildBreakpoints()
+	return result
+}
+
+func (s *dapSession) rebuildBreakpoints() {
+	breakpoints = make(map[uint16]bool)
+	for _, addrs := range s.sourceBreak {
+		for _, addr := range addrs {
+			breakpoints[addr] = true
+		}
+	}
+	for _, addr := range s.addrBreak {
+		breakpoints[addr] = true
+	}
+}
+
+func (s *dapSession) frame(id int, entry uint16, addr uint16) dapStackFrame {
+	frame := dapStackFrame{ID: id, Name: subroutineName(entry), Line: s.line(addr), Column: 1,
+		InstructionPointerReference: dapAddress(addr)}
+	if frame.Line > 0 {
+		frame.Source = s.listingSource()
+		if s.addrLines != nil {
+			frame.Source = &dapSource{Name: filepath.Base(s.source), Path: s.source}
+		}
+	}
+	return frame
+}
+
+func (s *dapSession) stackFrames() []dapStackFrame {
+	//The innermost frame is the pc, then each return address on the stack less two is the CALL the frame is stopped at.
+	//A frame is in the subroutine called by the frame outside it, the outermost is main
+	entry := func(depth int) uint16 {
+		if depth == 0 {
+			return profileMain
+		}
+		return cpu.opcodeAt(cpu.stack[depth-1]-2) & 0xFFF
+	}
+	depth := int(cpu.stkptr)
+	if depth > 16 {
+		depth = 16
+	}
+	frames := []dapStackFrame{s.frame(0, entry(depth), cpu.pc)}
+	for i := depth - 1; i >= 0; i-- {
+		frames = append(frames, s.frame(len(frames), entry(i), cpu.stack[i]-2))
+	}
+	return frames
+}
+
+func dapVariables(reference int) []dapVariable {
+	variables := make([]dapVariable, 0)
+	switch reference {
+	case dapRegisters:
+		for i, v := range cpu.V {
+			variables = append(variables, dapVariable{Name: fmt.Sprintf("V%X", i), Value: fmt.Sprintf("0x%02X (%d)", v, v)})
+		}
+		variables = append(variables,
+			dapVariable{Name: "I", Value: dapAddress(cpu.index), MemoryReference: dapAddress(cpu.index)},
+			dapVariable{Name: "PC", Value: dapAddress(cpu.pc), MemoryReference: dapAddress(cpu.pc)},
+			dapVariable{Name: "SP", Value: fmt.Sprint(cpu.stkptr)},
+			dapVariable{Name: "DT", Value: fmt.Sprint(cpu.delayTimer)},
+			dapVariable{Name: "ST", Value: fmt.Sprint(cpu.soundTimer)},
+		)
+	case dapMemory:
+		//16 bytes to a row
+		for row := 0; row < 0x1000; row += 16 {
+			bytes := make([]string, 16)
+			for i := range bytes {
+				bytes[i] = fmt.Sprintf("%02X", cpu.memory[row+i])
+			}
+			variables = append(variables, dapVariable{Name: dapAddress(uint16(row)), Value: strings.Join(bytes, " "),
+				MemoryReference: dapAddress(uint16(row))})
+		}
+	case dapKeys:
+		for key, held := range cpu.keyInputs {
+			variables = append(variables, dapVariable{Name: fmt.Sprintf("%X", key), Value: fmt.Sprint(held)})
+		}
+	case dapDisplay:
+		for y, row := range cpu.display {
+			var line strings.Builder
+			for _, pixel := range row {
+				if pixel != 0 {
+					line.WriteRune('█')
+				} else {
+					line.WriteRune('·')
+				}
+			}
+			variables = append(variables, dapVariable{Name: fmt.Sprintf("%02d", y), Value: line.String()})
+		}
+	}
+	return variables
+}
+
+func dapSetVariable(reference int, name string, value string) (string, error) {
+	//Registers take numbers in decimal or with a 0x prefix, keys take true or false so a rom waiting on one can be fed it
+	if reference == dapKeys {
+		key, err := strconv.ParseUint(name, 16, 4)
+		pressed, perr := strconv.ParseBool(value)
+		if err != nil || perr != nil {
+			return "", fmt.Errorf("keys are true or false")
+		}
+		cpu.setKey(uint8(key), pressed, "debug adapter")
+		return fmt.Sprint(pressed), nil
+	}
+	if reference != dapRegisters {
+		return "", fmt.Errorf("only registers and keys can be changed")
+	}
+
+	n, err := strconv.ParseUint(strings.Fields(value + " ")[0], 0, 16)
+	if err != nil {
+		return "", fmt.Errorf("invalid value %q", value)
+	}
+	switch {
+	case len(name) == 2 && name[0] == 'V':
+		x, err := strconv.ParseUint(name[1:], 16, 4)
+		if err != nil || n > 0xFF {
+			return "", fmt.Errorf("V registers hold a byte")
+		}
+		cpu.V[x] = uint8(n)
+		return fmt.Sprintf("0x%02X (%d)", n, n), nil
+	case name == "I" || name == "PC":
+		if n > 0xFFF {
+			return "", fmt.Errorf("%s holds an address below 0x1000", name)
+		}
+		if name == "PC" && (n%2 != 0 || n == 0xFFF) {
+			return "", fmt.Errorf("the PC has to be on an even address with a whole instruction after it")
+		}
+		if name == "I" {
+			cpu.index = uint16(n)
+		} else {
+			cpu.pc = uint16(n)
+			cpu.opcode = cpu.opcodeAt(cpu.pc)
+		}
+		return dapAddress(uint16(n)), nil
+	case name == "DT" || name == "ST":
+		if n > 0xFF {
+			return "", fmt.Errorf("timers hold a byte")
+		}
+		if name == "DT" {
+			cpu.delayTimer = uint8(n)
+		} else {
+			cpu.soundTimer = uint8(n)
+		}
+		return fmt.Sprint(n), nil
+	}
+	return "", fmt.Errorf("%s can't be changed", name)
+}
+
+func (s *dapSession) disassembly(start int, count int) []dapInstruction {
+	//Always gives count instructions, the ones outside memory are marked invalid
+	instructions := make([]dapInstruction, 0, count)
+	for i := 0; i < count; i++ {
+		addr := start + i*2
+		if addr < 0 || addr >= 0x1000 {
+			instructions = append(instructions, dapInstruction{Address: fmt.Sprintf("0x%X", addr&0xFFFF), Instruction: "??",
+				PresentationHint: "invalid"})
+			continue
+		}
+		opcode := cpu.opcodeAt(uint16(addr))
+		instruction := dapInstruction{Address: dapAddress(uint16(addr)), InstructionBytes: fmt.Sprintf("%02X %02X", opcode>>8, opcode&0xFF),
+			Instruction: disassemble(opcode), Symbol: symbols[uint16(addr)]}
+		if line := s.line(uint16(addr)); line > 0 && (i == 0 || s.line(uint16(addr-2)) != line) {
+			instruction.Line = line
+			instruction.Location = s.listingSource()
+			if s.addrLines != nil {
+				instruction.Location = &dapSource{Name: filepath.Base(s.source), Path: s.source}
+			}
+		}
+		instructions = append(instructions, instruction)
+	}
+	return instructions
+}
+
+func (s *dapSession) step() {
+	//A single instruction, the timers don't tick as they don't when stepping in the debugger
+	s.halt()
+	cpu.cycle()
+	s.after = append(s.after, func() { s.stopped("step", "") })
+}
+
+func (s *dapSession) halt() {
+	s.running = false
+	s.generation++
+}
+
+func (s *dapSession) resume(until func() bool) {
+	//Runs the rom in real time once the response is sent, until a breakpoint, a pause or until says it's done
+	s.halt()
+	s.running = true
+	resumed = true
+	generation := s.generation
+	s.after = append(s.after, func() { go s.run(generation, until) })
+}
+
+func (s *dapSession) run(generation int, until func() bool) {
+	ticker := time.NewTicker(time.Second / 60)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.lock.Lock()
+		if !s.running || s.generation != generation {
+			s.lock.Unlock()
+			return
+		}
+		reason, text := runDAPFrame(until)
+		if reason != "" {
+			s.halt()
+		}
+		s.lock.Unlock()
+
+		if reason != "" {
+			s.stopped(reason, text)
+			return
+		}
+	}
+}
+
+func runDAPFrame(until func() bool) (reason string, text string) {
+	//A crash while running stops the rom as an exception, so the editor can still look at what caused it
+	defer func() {
+		if r := recover(); r != nil {
+			reason, text = "exception", fmt.Sprintf("the emulator crashed: %v", r)
+		}
+	}()
+	return dapFrame(until), ""
+}
+
+func dapFrame(until func() bool) string {
+	//Runs a 60hz frame like emulateFrame, returning why it stopped early if it did
+	if cpu.delayTimer > 0 {
+		cpu.delayTimer--
+	}
+	if cpu.soundTimer > 0 {
+		cpu.soundTimer--
+	}
+
+	cpu.vblankWait = false
+	watchpointHit = false
+	for i := 0; i < speed/60 && !cpu.vblankWait; i++ {
+		//Breakpoints stop before the instruction runs, apart from the one running resumes from, as in the window
+		if breakpoints[cpu.pc] && !resumed {
+			return "breakpoint"
+		}
+		resumed = false
+
+		cpu.cycle()
+		if until != nil && until() {
+			return "step"
+		}
+		if watchpointHit {
+			return "data breakpoint"
+		}
+	}
+	return ""
+}
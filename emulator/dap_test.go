@@ -0,0 +1,441 @@
+package emulator
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+//dapMessage is any message from the adapter, responses and events alike
+type dapMessage struct {
+	Type       string          `json:"type"`
+	Command    string          `json:"command"`
+	Event      string          `json:"event"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Body       json.RawMessage `json:"body"`
+}
+
+//dapClient plays the editor's side of a session over a pipe
+type dapClient struct {
+	t        *testing.T
+	conn     net.Conn
+	seq      int
+	messages chan dapMessage
+	events   []dapMessage //Events that came in while waiting on a response
+}
+
+func newDAPClient(t *testing.T) (*dapClient, chan error) {
+	editor, adapter := net.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- newDAPSession(adapter, adapter).serve()
+		adapter.Close()
+	}()
+
+	c := &dapClient{t: t, conn: editor, messages: make(chan dapMessage, 64)}
+	go func() {
+		defer close(c.messages)
+		r := bufio.NewReader(editor)
+		for {
+			data, err := readDAPMessage(r)
+			if err != nil {
+				return
+			}
+			var message dapMessage
+			if err := json.Unmarshal(data, &message); err != nil {
+				t.Errorf("bad message from the adapter: %s", err)
+				return
+			}
+			c.messages <- message
+		}
+	}()
+	t.Cleanup(func() { editor.Close() })
+	return c, served
+}
+
+func (c *dapClient) next() dapMessage {
+	c.t.Helper()
+	select {
+	case message, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("the adapter closed the connection")
+		}
+		return message
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting on the adapter")
+	}
+	return dapMessage{}
+}
+
+func (c *dapClient) request(command string, args interface{}, body interface{}) dapMessage {
+	//Sends a request and waits on its response, decoding the body into body when it's given
+	c.t.Helper()
+	message := c.call(command, args)
+	if !message.Success {
+		c.t.Fatalf("%s failed: %s", command, message.Message)
+	}
+	if body != nil {
+		if err := json.Unmarshal(message.Body, body); err != nil {
+			c.t.Fatalf("%s: %s", command, err)
+		}
+	}
+	return message
+}
+
+func (c *dapClient) requestFails(command string, args interface{}) string {
+	//Sends a request that has to fail, returning the adapter's message
+	c.t.Helper()
+	message := c.call(command, args)
+	if message.Success {
+		c.t.Fatalf("%s succeeded, want it to fail", command)
+	}
+	return message.Message
+}
+
+func (c *dapClient) call(command string, args interface{}) dapMessage {
+	c.t.Helper()
+	c.seq++
+	data, err := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := writeDAPMessage(c.conn, data); err != nil {
+		c.t.Fatal(err)
+	}
+
+	for {
+		message := c.next()
+		if message.Type == "event" {
+			c.events = append(c.events, message)
+			continue
+		}
+		if message.RequestSeq != c.seq || message.Command != command {
+			c.t.Fatalf("got a response to %s %d waiting on %s %d", message.Command, message.RequestSeq, command, c.seq)
+		}
+		return message
+	}
+}
+
+func (c *dapClient) event(name string, body interface{}) {
+	c.t.Helper()
+	for {
+		var message dapMessage
+		if len(c.events) > 0 {
+			message, c.events = c.events[0], c.events[1:]
+		} else {
+			message = c.next()
+		}
+		if message.Type != "event" {
+			c.t.Fatalf("got a response to %s waiting on the %s event", message.Command, name)
+		}
+		if message.Event == name {
+			if body != nil {
+				if err := json.Unmarshal(message.Body, body); err != nil {
+					c.t.Fatalf("%s event: %s", name, err)
+				}
+			}
+			return
+		}
+	}
+}
+
+func writeDAPMessage(conn net.Conn, data []byte) error {
+	_, err := fmt.Fprintf(conn, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+func (c *dapClient) stoppedAt(reason string, pc string) {
+	c.t.Helper()
+	var stopped struct {
+		Reason string `json:"reason"`
+	}
+	c.event("stopped", &stopped)
+	if stopped.Reason != reason {
+		c.t.Errorf("stopped for %q, want %q", stopped.Reason, reason)
+	}
+	frames := c.stackTrace()
+	if frames[0].InstructionPointerReference != pc {
+		c.t.Errorf("stopped at %s, want %s", frames[0].InstructionPointerReference, pc)
+	}
+}
+
+func (c *dapClient) stackTrace() []dapStackFrame {
+	c.t.Helper()
+	var trace struct {
+		StackFrames []dapStackFrame `json:"stackFrames"`
+		TotalFrames int             `json:"totalFrames"`
+	}
+	c.request("stackTrace", map[string]interface{}{"threadId": 1}, &trace)
+	if len(trace.StackFrames) == 0 || trace.TotalFrames != len(trace.StackFrames) {
+		c.t.Fatalf("stack trace has %d frames, totalFrames says %d", len(trace.StackFrames), trace.TotalFrames)
+	}
+	return trace.StackFrames
+}
+
+func TestDAPSession(t *testing.T) {
+	defer func() { breakpoints = make(map[uint16]bool) }()
+	c, served := newDAPClient(t)
+
+	var capabilities map[string]bool
+	c.request("initialize", map[string]interface{}{"adapterID": "gochip8"}, &capabilities)
+	for _, capability := range []string{"supportsConfigurationDoneRequest", "supportsDisassembleRequest", "supportsReadMemoryRequest"} {
+		if !capabilities[capability] {
+			t.Errorf("initialize doesn't report %s", capability)
+		}
+	}
+
+	c.request("launch", map[string]interface{}{"program": "../roms/BRIX"}, nil)
+	c.event("initialized", nil)
+
+	//Line 1 of the listing is the first instruction, line 17 is the CALL at 220
+	var set struct {
+		Breakpoints []dapBreakpoint `json:"breakpoints"`
+	}
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"name": "BRIX (disassembly)", "sourceReference": dapListingReference},
+		"breakpoints": []map[string]int{{"line": 1}, {"line": 17}, {"line": 100000}},
+	}, &set)
+	want := []dapBreakpoint{
+		{Verified: true, Line: 1, InstructionReference: "0x200"},
+		{Verified: true, Line: 17, InstructionReference: "0x220"},
+		{Line: 100000, Message: "no code at this line"},
+	}
+	if len(set.Breakpoints) != len(want) {
+		t.Fatalf("setBreakpoints gave %+v, want %+v", set.Breakpoints, want)
+	}
+	for i := range want {
+		if set.Breakpoints[i] != want[i] {
+			t.Errorf("breakpoint %d is %+v, want %+v", i, set.Breakpoints[i], want[i])
+		}
+	}
+
+	//A breakpoint on the first instruction stops the rom before it runs
+	c.request("configurationDone", nil, nil)
+	c.stoppedAt("breakpoint", "0x200")
+	frames := c.stackTrace()
+	if len(frames) != 1 || frames[0].Name != "main" || frames[0].Line != 1 || frames[0].Source == nil ||
+		frames[0].Source.SourceReference != dapListingReference {
+		t.Errorf("stack trace at the start is %+v", frames)
+	}
+
+	var scopes struct {
+		Scopes []struct {
+			Name               string `json:"name"`
+			VariablesReference int    `json:"variablesReference"`
+		} `json:"scopes"`
+	}
+	c.request("scopes", map[string]interface{}{"frameId": 0}, &scopes)
+	if len(scopes.Scopes) != 4 || scopes.Scopes[0].Name != "Registers" || scopes.Scopes[0].VariablesReference != dapRegisters {
+		t.Fatalf("scopes are %+v", scopes.Scopes)
+	}
+
+	var variables struct {
+		Variables []dapVariable `json:"variables"`
+	}
+	c.request("variables", map[string]interface{}{"variablesReference": dapRegisters}, &variables)
+	registers := make(map[string]string)
+	for _, v := range variables.Variables {
+		registers[v.Name] = v.Value
+	}
+	if len(variables.Variables) != 21 || registers["V0"] != "0x00 (0)" || registers["PC"] != "0x200" || registers["SP"] != "0" {
+		t.Errorf("registers at the start are %+v", variables.Variables)
+	}
+
+	var disassembled struct {
+		Instructions []dapInstruction `json:"instructions"`
+	}
+	c.request("disassemble", map[string]interface{}{"memoryReference": "0x200", "instructionCount": 3}, &disassembled)
+	wantInstructions := []struct {
+		address, bytes string
+		opcode         uint16
+	}{{"0x200", "6E 05", 0x6E05}, {"0x202", "65 00", 0x6500}, {"0x204", "6B 06", 0x6B06}}
+	if len(disassembled.Instructions) != len(wantInstructions) {
+		t.Fatalf("disassembled %d instructions, want %d", len(disassembled.Instructions), len(wantInstructions))
+	}
+	for i, w := range wantInstructions {
+		got := disassembled.Instructions[i]
+		if got.Address != w.address || got.InstructionBytes != w.bytes || got.Instruction != disassemble(w.opcode) {
+			t.Errorf("instruction %d is %+v, want %s %s %s", i, got, w.address, w.bytes, disassemble(w.opcode))
+		}
+	}
+
+	//Counts are kept to what memory can hold
+	for _, tt := range []struct {
+		count, want int
+	}{{-1, 0}, {0, 0}, {1 << 30, 0x800}} {
+		c.request("disassemble", map[string]interface{}{"memoryReference": "0x000", "instructionCount": tt.count}, &disassembled)
+		if len(disassembled.Instructions) != tt.want {
+			t.Errorf("disassembling %d instructions gave %d, want %d", tt.count, len(disassembled.Instructions), tt.want)
+		}
+	}
+
+	var memory struct {
+		Address         string `json:"address"`
+		Data            string `json:"data"`
+		UnreadableBytes int    `json:"unreadableBytes"`
+	}
+	for _, tt := range []struct {
+		reference     string
+		offset, count int
+		address       string
+		data          []byte
+		unreadable    int
+	}{
+		{"0x200", 0, 4, "0x200", []byte{0x6E, 0x05, 0x65, 0x00}, 0},
+		{"0x000", -2, 4, "0x000", fontset[:2], 0},
+		{"0xFFE", 0, 4, "0xFFE", []byte{0, 0}, 2},
+		{"0x200", 0, -5, "0x200", []byte{}, 0},
+		{"0x000", 0, 1 << 30, "0x000", nil, 0},
+	} {
+		c.request("readMemory", map[string]interface{}{"memoryReference": tt.reference, "offset": tt.offset, "count": tt.count}, &memory)
+		data, err := base64.StdEncoding.DecodeString(memory.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.data == nil {
+			tt.data = cpu.memory[:]
+		}
+		if memory.Address != tt.address || string(data) != string(tt.data) || memory.UnreadableBytes != tt.unreadable {
+			t.Errorf("reading %d bytes at %s%+d gave %d bytes at %s with %d unreadable, want %d at %s with %d unreadable",
+				tt.count, tt.reference, tt.offset, len(data), memory.Address, memory.UnreadableBytes, len(tt.data), tt.address, tt.unreadable)
+		}
+	}
+
+	//Continuing runs the instruction it stopped on rather than breaking on it again
+	c.request("continue", map[string]interface{}{"threadId": 1}, nil)
+	c.stoppedAt("breakpoint", "0x220")
+
+	c.request("stepIn", map[string]interface{}{"threadId": 1}, nil)
+	c.stoppedAt("step", "0x2F6")
+	frames = c.stackTrace()
+	if len(frames) != 2 || frames[0].Name != "sub_2F6" || frames[1].Name != "main" || frames[1].InstructionPointerReference != "0x220" {
+		t.Errorf("stack trace in the subroutine is %+v", frames)
+	}
+
+	c.request("stepOut", map[string]interface{}{"threadId": 1}, nil)
+	c.stoppedAt("step", "0x222")
+
+	//Next runs a whole subroutine, even over the breakpoint it's sitting on
+	c.request("setVariable", map[string]interface{}{"variablesReference": dapRegisters, "name": "PC", "value": "0x220"}, nil)
+	c.request("next", map[string]interface{}{"threadId": 1}, nil)
+	c.stoppedAt("step", "0x222")
+	if frames := c.stackTrace(); len(frames) != 1 {
+		t.Errorf("next left %d frames, want 1", len(frames))
+	}
+
+	//The pc can't be left where fetching an instruction would run off the end of memory
+	for _, pc := range []string{"0xFFF", "0x221", "0x1000"} {
+		c.requestFails("setVariable", map[string]interface{}{"variablesReference": dapRegisters, "name": "PC", "value": pc})
+	}
+	c.request("setVariable", map[string]interface{}{"variablesReference": dapRegisters, "name": "PC", "value": "0xFFE"}, nil)
+	c.request("stepIn", map[string]interface{}{"threadId": 1}, nil)
+	c.event("stopped", nil)
+	if frames := c.stackTrace(); frames[0].InstructionPointerReference != "0x000" {
+		t.Errorf("stepping at FFE went to %s, want 0x000", frames[0].InstructionPointerReference)
+	}
+
+	c.request("disconnect", nil, nil)
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("serve: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the adapter didn't finish after disconnect")
+	}
+}
+
+func TestDAPLaunchForgetsEarlierSessions(t *testing.T) {
+	//Breakpoints and labels from the rom debugged before mustn't turn up in the next one
+	defer func() { breakpoints = make(map[uint16]bool) }()
+	breakpoints = map[uint16]bool{0x206: true}
+	symbols = map[uint16]string{0x200: "stale"}
+
+	c, served := newDAPClient(t)
+	c.request("initialize", nil, nil)
+	c.request("launch", map[string]interface{}{"program": "../roms/BRIX", "stopOnEntry": true}, nil)
+	c.event("initialized", nil)
+	c.request("configurationDone", nil, nil)
+	c.stoppedAt("entry", "0x200")
+
+	var disassembled struct {
+		Instructions []dapInstruction `json:"instructions"`
+	}
+	c.request("disassemble", map[string]interface{}{"memoryReference": "0x200", "instructionCount": 1}, &disassembled)
+	if symbol := disassembled.Instructions[0].Symbol; symbol != "" {
+		t.Errorf("0x200 is labelled %q from an earlier session", symbol)
+	}
+	c.request("next", map[string]interface{}{"threadId": 1}, nil)
+	c.stoppedAt("step", "0x202")
+	//BRIX's loop drawing the bricks goes through 206 within a frame
+	c.request("continue", map[string]interface{}{"threadId": 1}, nil)
+	time.Sleep(100 * time.Millisecond)
+	c.request("pause", map[string]interface{}{"threadId": 1}, nil)
+	var stopped struct {
+		Reason string `json:"reason"`
+	}
+	c.event("stopped", &stopped)
+	if stopped.Reason != "pause" {
+		t.Errorf("stopped for %q after continuing, want pause as there are no breakpoints", stopped.Reason)
+	}
+
+	c.request("disconnect", nil, nil)
+	if err := <-served; err != nil {
+		t.Errorf("serve: %s", err)
+	}
+}
+
+func TestDAPStepBack(t *testing.T) {
+	defer func() { breakpoints = make(map[uint16]bool) }()
+	c, served := newDAPClient(t)
+	c.request("initialize", nil, nil)
+	c.request("launch", map[string]interface{}{"program": "../roms/BRIX", "stopOnEntry": true}, nil)
+	c.event("initialized", nil)
+	c.request("configurationDone", nil, nil)
+	c.stoppedAt("entry", "0x200")
+
+	//Nothing has run, so there's nothing to go back to
+	for _, command := range []string{"stepBack", "reverseContinue"} {
+		if message := c.requestFails(command, map[string]interface{}{"threadId": 1}); message != "no history to go back through" {
+			t.Errorf("%s with no history failed with %q", command, message)
+		}
+	}
+
+	for _, pc := range []string{"0x202", "0x204", "0x206"} {
+		c.request("next", map[string]interface{}{"threadId": 1}, nil)
+		c.stoppedAt("step", pc)
+	}
+	c.request("setInstructionBreakpoints", map[string]interface{}{"breakpoints": []map[string]string{{"instructionReference": "0x202"}}}, nil)
+
+	var stopped struct {
+		Reason      string `json:"reason"`
+		Description string `json:"description"`
+	}
+	for _, want := range []struct {
+		reason, description, pc string
+	}{
+		{"breakpoint", "breakpoint at 202", "0x202"},
+		{"step", "reached the start of history", "0x200"},
+	} {
+		c.request("reverseContinue", map[string]interface{}{"threadId": 1}, nil)
+		c.event("stopped", &stopped)
+		if stopped.Reason != want.reason || stopped.Description != want.description {
+			t.Errorf("reverse continue stopped for %q %q, want %q %q", stopped.Reason, stopped.Description, want.reason, want.description)
+		}
+		if frames := c.stackTrace(); frames[0].InstructionPointerReference != want.pc {
+			t.Errorf("reverse continue stopped at %s, want %s", frames[0].InstructionPointerReference, want.pc)
+		}
+	}
+	c.requestFails("stepBack", map[string]interface{}{"threadId": 1})
+
+	c.request("disconnect", nil, nil)
+	if err := <-served; err != nil {
+		t.Errorf("serve: %s", err)
+	}
+}
@@ -0,0 +1,222 @@
+package emulator
+
+import (
+	"crypto/sha1"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+//The database files follow the layout of the community chip-8-database (https://github.com/chip-8/chip-8-database)
+//so newer copies of programs.json, sha1-hashes.json and platforms.json can be dropped in as is
+
+//go:embed database/*.json
+var databaseFiles embed.FS
+
+//program is a single entry of programs.json
+type program struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description"`
+	Release     string              `json:"release"`
+	Authors     []string            `json:"authors"`
+	Roms        map[string]romEntry `json:"roms"`
+}
+
+//romEntry describes one released version of a program, keyed by its sha1 hash
+type romEntry struct {
+	File            string                     `json:"file"`
+	Platforms       []string                   `json:"platforms"`
+	Tickrate        int                        `json:"tickrate"`
+	QuirkyPlatforms map[string]map[string]bool `json:"quirkyPlatforms"`
+	Keys            map[string]int             `json:"keys"`
+	Colors          romColors                  `json:"colors"`
+}
+
+//romColors are the colours a rom was designed to be shown in
+type romColors struct {
+	Pixels  []string `json:"pixels"`
+	Buzzer  string   `json:"buzzer"`
+	Silence string   `json:"silence"`
+}
+
+//platform is a single entry of platforms.json
+type platform struct {
+	ID              string          `json:"id"`
+	Name            string          `json:"name"`
+	DefaultTickrate int             `json:"defaultTickrate"`
+	Quirks          map[string]bool `json:"quirks"`
+}
+
+//romInfo is everything the emulator knows about a loaded rom
+type romInfo struct {
+	hash     string
+	known    bool //Whether the rom was found in the database
+	program  program
+	entry    romEntry
+	platform platform
+	quirks   quirks
+	tickrate int //Recommended instructions per frame
+}
+
+var programs []program
+var hashes map[string]int
+var platforms map[string]platform
+
+func loadDatabase() {
+	//Parses the embedded database the first time it is needed
+	if programs != nil {
+		return
+	}
+
+	data, err := databaseFiles.ReadFile("database/programs.json")
+	checkErr(err, "couldn't read programs.json")
+	checkErr(json.Unmarshal(data, &programs), "couldn't parse programs.json")
+
+	data, err = databaseFiles.ReadFile("database/sha1-hashes.json")
+	checkErr(err, "couldn't read sha1-hashes.json")
+	checkErr(json.Unmarshal(data, &hashes), "couldn't parse sha1-hashes.json")
+
+	platformList := make([]platform, 0)
+	data, err = databaseFiles.ReadFile("database/platforms.json")
+	checkErr(err, "couldn't read platforms.json")
+	checkErr(json.Unmarshal(data, &platformList), "couldn't parse platforms.json")
+
+	platforms = make(map[string]platform)
+	for _, p := range platformList {
+		platforms[p.ID] = p
+	}
+}
+
+func lookupRom(data []uint8) romInfo {
+	//Finds the rom in the database by its sha1 hash, falling back to the default quirks if it isn't there
+	loadDatabase()
+
+	sum := sha1.Sum(data)
+	info := romInfo{hash: hex.EncodeToString(sum[:]), quirks: defaultQuirks}
+
+	index, ok := hashes[info.hash]
+	if !ok || index >= len(programs) {
+		return info
+	}
+
+	info.known = true
+	info.program = programs[index]
+	info.entry = info.program.Roms[info.hash]
+
+	//The first platform listed that we know about is the one the rom is run as
+	for _, id := range info.entry.Platforms {
+		if p, ok := platforms[id]; ok {
+			info.platform = p
+			info.quirks.apply(p.Quirks)
+			info.quirks.apply(info.entry.QuirkyPlatforms[id])
+			info.tickrate = p.DefaultTickrate
+			break
+		}
+	}
+	if info.entry.Tickrate > 0 {
+		info.tickrate = info.entry.Tickrate
+	}
+
+	return info
+}
+
+func (q *quirks) apply(values map[string]bool) {
+	//Overrides quirks with the values from the database
+	for name, value := range values {
+		switch name {
+		case "shift":
+			q.shift = value
+		case "memoryIncrementByX":
+			q.memoryIncrementByX = value
+		case "memoryLeaveIUnchanged":
+			q.memoryLeaveIUnchanged = value
+		case "wrap":
+			q.wrap = value
+		case "jump":
+			q.jump = value
+		case "vblank":
+			q.vblank = value
+		case "logic":
+			q.logic = value
+		}
+	}
+}
+
+func (q quirks) String() string {
+	enabled := make([]string, 0)
+	for _, quirk := range []struct {
+		name string
+		on   bool
+	}{
+		{"shift", q.shift},
+		{"memoryIncrementByX", q.memoryIncrementByX},
+		{"memoryLeaveIUnchanged", q.memoryLeaveIUnchanged},
+		{"wrap", q.wrap},
+		{"jump", q.jump},
+		{"vblank", q.vblank},
+		{"logic", q.logic},
+	} {
+		if quirk.on {
+			enabled = append(enabled, quirk.name)
+		}
+	}
+
+	if len(enabled) == 0 {
+		return "none"
+	}
+	return strings.Join(enabled, ", ")
+}
+
+func printRomInfo(filePath string) {
+	//Prints what the database knows about a rom, used by `gochip8 info`
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	info := lookupRom(data)
+	fmt.Printf("File:      %s\n", filePath)
+	fmt.Printf("SHA1:      %s\n", info.hash)
+	if !info.known {
+		fmt.Println("Not found in the rom database")
+		fmt.Printf("Quirks:    %s\n", info.quirks)
+		return
+	}
+
+	fmt.Printf("Title:     %s\n", info.program.Title)
+	if len(info.program.Authors) > 0 {
+		fmt.Printf("Authors:   %s\n", strings.Join(info.program.Authors, ", "))
+	}
+	if info.program.Release != "" {
+		fmt.Printf("Released:  %s\n", info.program.Release)
+	}
+	if info.program.Description != "" {
+		fmt.Printf("About:     %s\n", info.program.Description)
+	}
+	if info.platform.ID != "" {
+		fmt.Printf("Platform:  %s (%s)\n", info.platform.Name, info.platform.ID)
+	} else {
+		fmt.Printf("Platform:  %s (unsupported)\n", strings.Join(info.entry.Platforms, ", "))
+	}
+	if info.tickrate > 0 {
+		fmt.Printf("Speed:     %d instructions per frame\n", info.tickrate)
+	}
+	fmt.Printf("Quirks:    %s\n", info.quirks)
+
+	if len(info.entry.Keys) > 0 {
+		fmt.Println("Keys:")
+		names := make([]string, 0)
+		for name := range info.entry.Keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("  %-12s %X\n", name, info.entry.Keys[name])
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package emulator
+
+import (
+	"os"
+	"strings"
+
+	ui "github.com/gizak/termui/v3"
+)
+
+//The termui debugger is off unless asked for with -debug or the config, and can be attached or detached with a hotkey
+var debuggerShown bool = false
+
+//termuiOpen is whether termui has the terminal, it has to be given back before exiting or the terminal is left raw
+var termuiOpen bool = false
+
+//Panes that take keys typed into the terminal, tab moves between them. The game only takes keys from the terminal
+//in the terminal frontend, the window gets them otherwise
+const (
+	focusGame    = "game"
+	focusMemory  = "memory"
+	focusSprites = "sprites"
+	focusHistory = "history"
+)
+
+var debuggerFocus string = focusMemory
+
+//debuggerEvents is termui's event channel, only ever made once as termui keeps reading the terminal for it
+var debuggerEvents <-chan ui.Event
+
+//interrupted receives ctrl+c and kill signals so the main loop can stop and put the terminal back first
+var interrupted = make(chan os.Signal, 1)
+
+func openTermui() {
+	if !termuiOpen {
+		checkErr(ui.Init(), "Failed to intialise termui")
+		termuiOpen = true
+	}
+}
+
+func closeTermui() {
+	if termuiOpen {
+		ui.Close()
+		termuiOpen = false
+	}
+}
+
+func restoreTerminal() {
+	//Deferred by RunEmulator, closes termui on the way out even when panicking so the panic can be read
+	if r := recover(); r != nil {
+		closeTermui()
+		panic(r)
+	}
+	closeTermui()
+}
+
+func checkInterrupted() {
+	select {
+	case <-interrupted:
+		running = false
+	default:
+	}
+}
+
+func toggleDebugger() {
+	//The terminal frontend already has termui open, so the panes are only hidden there
+	debuggerShown = !debuggerShown
+	if terminalMode {
+		ui.Clear()
+		terminalDirty = true
+		return
+	}
+
+	if debuggerShown {
+		openTermui()
+		refreshDebugger()
+	} else {
+		closeTermui()
+	}
+}
+
+func refreshDebugger() {
+	//Fills the panes from the cpu, skipped while the debugger isn't shown as formatting them every cycle isn't cheap
+	if !debuggerShown {
+		return
+	}
+	instructionDebug.Text = "\n" + strings.Join(instructionSlice[:], "\n")
+	cpuVDebug.Text, cpuGDebug.Text, debugMode.Text, cpuStack.Text = getDebugInformation(*cpu, executing, stepMode)
+}
+
+func renderDebugger() {
+	if !debuggerShown {
+		return
+	}
+	updateMemoryPane()
+	updateSpritePane()
+	updateInputPane()
+	updateStatsPane()
+	updateHistoryPane()
+	memoryPane.BorderStyle.Fg = ui.ColorGreen
+	spritePane.BorderStyle.Fg = ui.ColorCyan
+	historyPane.BorderStyle.Fg = ui.ColorRed
+	switch debuggerFocus {
+	case focusMemory:
+		memoryPane.BorderStyle.Fg = ui.ColorYellow
+	case focusSprites:
+		spritePane.BorderStyle.Fg = ui.ColorYellow
+	case focusHistory:
+		historyPane.BorderStyle.Fg = ui.ColorYellow
+	}
+	ui.Render(instructionDebug, cpuVDebug, cpuGDebug, cpuStack, debugMode, memoryPane, spritePane, inputPane, statsPane, historyPane)
+	if heatmapShown {
+		ui.Render(heatmapPane)
+	}
+}
+
+func termuiEvents() <-chan ui.Event {
+	if debuggerEvents == nil {
+		debuggerEvents = ui.PollEvents()
+	}
+	return debuggerEvents
+}
+
+func focusOrder() []string {
+	if terminalMode {
+		return []string{focusGame, focusMemory, focusSprites, focusHistory}
+	}
+	return []string{focusMemory, focusSprites, focusHistory}
+}
+
+func cycleFocus() {
+	order := focusOrder()
+	for i, pane := range order {
+		if pane == debuggerFocus {
+			debuggerFocus = order[(i+1)%len(order)]
+			return
+		}
+	}
+	debuggerFocus = order[0]
+}
+
+func handleDebuggerKey(id string) bool {
+	//Passes a key typed into the terminal to the focused pane, returning whether it was used
+	if !debuggerShown {
+		return false
+	}
+	if id == "<Tab>" {
+		cycleFocus()
+		return true
+	}
+	switch debuggerFocus {
+	case focusMemory:
+		return handleMemoryKey(id)
+	case focusSprites:
+		return handleSpriteKey(id)
+	case focusHistory:
+		return handleHistoryKey(id)
+	}
+	return false
+}
+
+func pollDebugger() {
+	//Handles keys typed into the debugger's terminal while the game has a window of its own
+	if !termuiOpen || terminalMode {
+		return
+	}
+	for {
+		select {
+		case e := <-termuiEvents():
+			if e.Type != ui.KeyboardEvent {
+				continue
+			}
+			if e.ID == "<C-c>" {
+				running = false
+			} else if !handleDebuggerKey(e.ID) {
+				//Hotkeys work from the terminal too
+				if key, ok := terminalKey(e.ID); ok {
+					if action, isHotkey := hotkeys[key]; isHotkey {
+						performAction(action)
+					}
+				}
+			}
+		default:
+			return
+		}
+	}
+}
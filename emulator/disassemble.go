@@ -0,0 +1,101 @@
+package emulator
+
+import "fmt"
+
+func disassemble(opcode uint16) string {
+	//Formats an opcode the same way the instructions pane does, without running it
+	identifier := (opcode & 0xF000) >> 12
+	addr := (opcode & 0x0FFF)
+	kk := uint8(opcode & 0x00FF)
+	x := uint8(opcode & 0x0F00 >> 8)
+	y := uint8(opcode&0x00F0) >> 4
+	n := uint8(opcode & 0x000F)
+
+	switch identifier {
+	case 0x0:
+		if kk == 0xE0 {
+			return "CLS"
+		} else if kk == 0xEE {
+			return "RET"
+		}
+	case 0x1:
+		return fmt.Sprintf("JP #%X", addr)
+	case 0x2:
+		return fmt.Sprintf("CALL #%X", addr)
+	case 0x3:
+		return fmt.Sprintf("SE V%X #%X", x, kk)
+	case 0x4:
+		return fmt.Sprintf("SNE V%X #%X", x, kk)
+	case 0x5:
+		return fmt.Sprintf("SE V%X V%X", x, y)
+	case 0x6:
+		return fmt.Sprintf("LD V%X #%X", x, kk)
+	case 0x7:
+		return fmt.Sprintf("ADD V%X #%X", x, kk)
+	case 0x8:
+		switch n {
+		case 0x0:
+			return fmt.Sprintf("LD V%X V%X", x, y)
+		case 0x1:
+			return fmt.Sprintf("OR V%X V%X", x, y)
+		case 0x2:
+			return fmt.Sprintf("AND V%X V%X", x, y)
+		case 0x3:
+			return fmt.Sprintf("XOR V%X V%X", x, y)
+		case 0x4:
+			return fmt.Sprintf("ADD V%X V%X", x, y)
+		case 0x5:
+			return fmt.Sprintf("SUB V%X V%X", x, y)
+		case 0x6:
+			return fmt.Sprintf("SHR V%X", x)
+		case 0x7:
+			return fmt.Sprintf("SUBN V%X V%X", x, y)
+		case 0xE:
+			return fmt.Sprintf("SHL V%X", x)
+		}
+	case 0x9:
+		return fmt.Sprintf("SNE V%X V%X", x, y)
+	case 0xA:
+		return fmt.Sprintf("LD I #%X", addr)
+	case 0xB:
+		return fmt.Sprintf("JP V0 #%X", addr)
+	case 0xC:
+		return fmt.Sprintf("RND V%X #%X", x, kk)
+	case 0xD:
+		return fmt.Sprintf("DRW V%X V%X #%X", x, y, n)
+	case 0xE:
+		if n == 0xE {
+			return fmt.Sprintf("SKP V%X", x)
+		} else if n == 0x1 {
+			return fmt.Sprintf("SKNP V%X", x)
+		}
+	case 0xF:
+		switch kk {
+		case 0x07:
+			return fmt.Sprintf("LD V%X DT", x)
+		case 0x0A:
+			return fmt.Sprintf("LD V%X K", x)
+		case 0x15:
+			return fmt.Sprintf("LD DT V%X", x)
+		case 0x18:
+			return fmt.Sprintf("LD ST V%X", x)
+		case 0x1E:
+			return fmt.Sprintf("ADD I V%X", x)
+		case 0x29:
+			return fmt.Sprintf("LD F V%X", x)
+		case 0x33:
+			return fmt.Sprintf("LD B V%X", x)
+		case 0x55:
+			return fmt.Sprintf("LD I V%X", x)
+		case 0x65:
+			return fmt.Sprintf("LD V%X I", x)
+		}
+	}
+
+	return fmt.Sprintf("ERR: #%X", opcode)
+}
+
+func (c *CPU) opcodeAt(addr uint16) uint16 {
+	//Reads the two bytes of an instruction, wrapping at the end of memory
+	return uint16(c.memory[addr&0xFFF])<<8 | uint16(c.memory[(addr+1)&0xFFF])
+}
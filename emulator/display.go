@@ -0,0 +1,114 @@
+package emulator
+
+import (
+	"encoding/binary"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+//displayTexture holds the filtered framebuffer, it's streamed to every frame and scaled up by the renderer
+//Filters change its size, so it's recreated whenever the output of the filter doesn't fit
+var displayTexture *sdl.Texture
+var textureWidth, textureHeight int = 64, 32
+
+//scaling is either "integer", which keeps every chip8 pixel the same size, or "fit", which fills as much of the window as it can
+var scaling string = "integer"
+
+func initDisplayTexture(renderer *sdl.Renderer) *sdl.Texture {
+	texture, err := renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_STREAMING, 64, 32)
+	checkErr(err, "texture creation error")
+	return texture
+}
+
+func updateDisplayTexture(frame *[32][64]uint32) {
+	//Runs the coloured framebuffer through the active filter and copies the result into the texture
+	uploadTexture(activeFilter().apply(frameBuffer(frame)))
+}
+
+func uploadTexture(b pixelBuffer) {
+	//Copies a buffer into the texture, recreating it if the size has changed
+	if b.width != textureWidth || b.height != textureHeight {
+		texture, err := renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_STREAMING, int32(b.width), int32(b.height))
+		if err != nil {
+			return
+		}
+		displayTexture.Destroy()
+		displayTexture = texture
+		textureWidth, textureHeight = b.width, b.height
+	}
+
+	pixels, pitch, err := displayTexture.Lock(nil)
+	if err != nil {
+		return
+	}
+	for y := 0; y < b.height; y++ {
+		for x := 0; x < b.width; x++ {
+			//ARGB8888 is a packed format, so the byte order is the machine's, which is little endian nearly everywhere
+			binary.LittleEndian.PutUint32(pixels[y*pitch+x*4:], 0xFF000000|b.pixels[y*b.width+x])
+		}
+	}
+	displayTexture.Unlock()
+}
+
+func redraw() {
+	//Shows the display on whichever frontend is running
+	if terminalMode {
+		terminalDirty = true
+		return
+	}
+	drawFromArray(window, surface, renderer, &cpu.display)
+}
+
+func displayArea() (int32, int32) {
+	//Size of the part of the window the display is drawn in, which is everything above the keypad
+	w, h := window.GetSize()
+	if h < keypadHeight() {
+		return w, 0
+	}
+	return w, h - keypadHeight()
+}
+
+func displayRect() sdl.Rect {
+	//Where the display goes, scaled to fit inside the border and centered
+	w, h := displayArea()
+	availableW, availableH := w-perim*2, h-perim*2
+	if availableW < 0 {
+		availableW = 0
+	}
+	if availableH < 0 {
+		availableH = 0
+	}
+
+	var displayW, displayH int32
+	if scaling == "fit" {
+		//Keep the 2:1 aspect ratio, letting the narrower side decide
+		displayW, displayH = availableW, availableW/2
+		if displayH > availableH {
+			displayW, displayH = availableH*2, availableH
+		}
+	} else {
+		scale := availableW / 64
+		if availableH/32 < scale {
+			scale = availableH / 32
+		}
+		if scale < 1 {
+			scale = 1
+		}
+		displayW, displayH = 64*scale, 32*scale
+	}
+
+	return sdl.Rect{X: (w - displayW) / 2, Y: (h - displayH) / 2, W: displayW, H: displayH}
+}
+
+func isFullscreen() bool {
+	return window.GetFlags()&sdl.WINDOW_FULLSCREEN != 0
+}
+
+func toggleFullscreen() {
+	if isFullscreen() {
+		window.SetFullscreen(0)
+	} else {
+		window.SetFullscreen(sdl.WINDOW_FULLSCREEN_DESKTOP)
+	}
+	drawFromArray(window, surface, renderer, &cpu.display)
+}
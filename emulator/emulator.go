@@ -1,6 +1,302 @@
 package emulator
 
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+var speedGiven bool = false //Whether the speed was given on the command line rather than taken from the rom database
+var watching bool = false   //Whether the rom is reloaded when the file changes
+var loadError string        //Why the last rom dropped or picked from the browser couldn't be opened, shown in the title
+
 //RunEmulator Run everything
-func RunEmulator(){
-	runWindow()
-}
\ No newline at end of file
+func RunEmulator() {
+	if len(os.Args) > 1 && os.Args[1] == "info" {
+		if len(os.Args) < 3 {
+			fmt.Println("usage: gochip8 info [path/to/rom]")
+			os.Exit(1)
+		}
+		printRomInfo(os.Args[2])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "dap" {
+		if err := runDAP(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	configPath := flag.String("config", "gochip8.toml", "path to the config file")
+	breakList := flag.String("break", "", "comma separated list of hex addresses to break at")
+	watchList := flag.String("watchpoint", "", "comma separated list of hex addresses to break after the rom writes to")
+	flag.BoolVar(&watching, "watch", false, "reload the rom whenever the file changes")
+	flag.BoolVar(&headless, "headless", false, "run without a window or debugger, for captures")
+	debugFlag := flag.Bool("debug", false, "open the debugger in the terminal at start")
+	termFlag := flag.String("terminal", "", "draw the display in the terminal instead of a window: halfblock, braille, sixel or kitty")
+	flag.IntVar(&screenshotScale, "screenshot-scale", 0, "size of screenshots and recordings as a multiple of 64x32, above 1 the filter is applied")
+	flag.StringVar(&recordPath, "record-gif", "", "record a gif of the rom, with the buzzer in a wav next to it, when running headless")
+	flag.IntVar(&recordFrames, "frames", 600, "number of frames to run for when recording or profiling headless")
+	audioPath := flag.String("audio-out", "", "write the buzzer to a wav file, rendered frame by frame with the emulation")
+	profilePath := flag.String("profile", "", "count the instructions run at each address and write a pprof profile on exit")
+	flag.IntVar(&profileTop, "profile-top", 20, "number of hot spots printed on exit when profiling, 0 for none")
+	flag.StringVar(&coveragePath, "coverage", "", "write a report of the addresses run, read and written to a file on exit")
+	flag.StringVar(&statsPath, "stats", "", "write counts of the instructions run, skips, draws and key waits to a json file on exit")
+	symbolsPath := flag.String("symbols", "", "symbol map naming addresses in the rom, used by the coverage report and profiler")
+	flag.Usage = func() {
+		fmt.Println("usage: gochip8 [flags] [path/to/rom] [speed]")
+		fmt.Println("Without a rom the rom browser is shown")
+		flag.PrintDefaults()
+		fmt.Println("  -screenshot-at-frame N out.png")
+		fmt.Println("    \tsave a screenshot once N frames have been shown")
+	}
+	args, err := takeScreenshotArgs(os.Args[1:])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	flag.CommandLine.Parse(args)
+
+	//The default config file is optional, one given with -config isn't
+	configGiven := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			configGiven = true
+		}
+	})
+	loadConfig(*configPath, configGiven)
+	hotkeys = buildHotkeys()
+	loadPalettes()
+	if settings.RomDir != "" {
+		romDir = settings.RomDir
+	}
+	loadRecentRoms()
+
+	checkErr(parseBreakpoints(*breakList), "invalid breakpoint list")
+	checkErr(parseWatchpoints(*watchList), "invalid watchpoint list")
+
+	//Use the speed given on the command line, otherwise the one recommended by the rom database
+	if flag.NArg() > 1 {
+		s, err := strconv.Atoi(flag.Arg(1))
+		checkErr(err, "speed must be a number")
+		speed = s
+		speedGiven = true
+	}
+
+	keypadShown = settings.Keypad
+	if settings.History != nil {
+		historyLength = *settings.History
+	}
+	if settings.Present != "" {
+		mode, err := parsePresentMode(settings.Present)
+		if err != nil {
+			fmt.Println(err)
+		}
+		presentMode = mode
+	}
+	if settings.BlendFrames > 0 {
+		blendFrames = settings.BlendFrames
+	}
+	if settings.PhosphorFrames > 0 {
+		phosphorFrames = settings.PhosphorFrames
+	}
+	if settings.Filter != "" {
+		if err := selectFilter(settings.Filter); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if settings.RecordFormat != "" {
+		recordFormat = settings.RecordFormat
+	}
+	if screenshotScale < 1 {
+		screenshotScale = 1
+		if settings.ScreenshotScale > 0 {
+			screenshotScale = settings.ScreenshotScale
+		}
+	}
+
+	if *audioPath != "" {
+		audioOut = &wavCapture{path: *audioPath}
+	}
+	if *symbolsPath != "" {
+		if err := loadSymbols(*symbolsPath); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+	defer saveCoverage()
+	defer saveStats()
+	if *profilePath != "" {
+		profiling = newProfiler(*profilePath)
+		defer saveProfile()
+	}
+
+	//Recordings in the window or terminal are started and stopped with the record hotkey instead
+	if recordPath != "" && !headless {
+		fmt.Println("-record-gif only works with -headless, use the record hotkey to record in the window or terminal")
+		os.Exit(2)
+	}
+	if headless {
+		if err := runHeadless(flag.Arg(0)); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if settings.Scale > 0 {
+		multiplier = settings.Scale
+	}
+	if settings.Border != nil && *settings.Border >= 0 {
+		perim = *settings.Border
+	}
+	if settings.Scaling == "fit" || settings.Scaling == "integer" {
+		scaling = settings.Scaling
+	} else if settings.Scaling != "" {
+		fmt.Printf("unknown scaling %q, using integer\n", settings.Scaling)
+	}
+	if settings.Buzzer.Frequency > 0 {
+		buzzerFrequency = settings.Buzzer.Frequency
+	}
+	if settings.Buzzer.Volume != nil {
+		buzzerVolume = math.Max(0, math.Min(1, *settings.Buzzer.Volume))
+	}
+	if settings.Buzzer.Waveform == "square" || settings.Buzzer.Waveform == "sine" {
+		buzzerWaveform = settings.Buzzer.Waveform
+	} else if settings.Buzzer.Waveform != "" {
+		fmt.Printf("unknown waveform %q, using square\n", settings.Buzzer.Waveform)
+	}
+	muted = settings.Buzzer.Muted
+
+	if *termFlag != "" {
+		terminalMode = true
+		terminalStyle = *termFlag
+		if !validTerminalStyle(terminalStyle) {
+			fmt.Printf("unknown terminal style %q, use one of %s\n", terminalStyle, strings.Join(terminalStyles, ", "))
+			os.Exit(2)
+		}
+		if flag.Arg(0) == "" {
+			fmt.Println("the terminal frontend needs a rom, there's no rom browser")
+			os.Exit(2)
+		}
+	}
+
+	//termui is only opened for the debugger, or for the terminal frontend which draws with it
+	debuggerShown = *debugFlag || settings.Debugger
+	defer saveAudioOut() //Captures are written after termui is closed so any error can be seen
+	defer stopRecording()
+	defer restoreTerminal()
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	if terminalMode || debuggerShown {
+		openTermui()
+	}
+
+	//The debugger panes sit beneath the display in the terminal
+	if terminalMode {
+		terminalScreen = newTerminalDisplay()
+		instructionDebug, cpuVDebug, cpuGDebug, cpuStack, debugMode = initDebugging(terminalScreen.Max.Y)
+		memoryPane = initMemoryPane(terminalScreen.Max.Y + 30)
+		spritePane = initSpritePane(terminalScreen.Max.Y + 30)
+		inputPane = initInputPane(terminalScreen.Max.Y)
+		statsPane = initStatsPane(terminalScreen.Max.Y + 16)
+		historyPane = initHistoryPane(terminalScreen.Max.Y + 48)
+		heatmapPane = newHeatmapPane(terminalScreen.Max.Y + 48)
+		debuggerFocus = focusGame
+	} else {
+		window, surface, renderer = initWindow()
+		displayTexture = initDisplayTexture(renderer)
+		instructionDebug, cpuVDebug, cpuGDebug, cpuStack, debugMode = initDebugging(0)
+		memoryPane = initMemoryPane(30)
+		spritePane = initSpritePane(30)
+		inputPane = initInputPane(0)
+		statsPane = initStatsPane(16)
+		historyPane = initHistoryPane(48)
+		heatmapPane = newHeatmapPane(48)
+
+		//Destroy window and quit SDL subsystems
+		defer sdl.Quit()
+		defer window.Destroy()
+		defer renderer.Destroy()
+		defer displayTexture.Destroy()
+	}
+	audio = initAudio(settings.Audio)
+	defer audio.close()
+
+	//A rom from the command line that can't be read ends the run, one picked in the rom browser goes back to it
+	romPath := flag.Arg(0)
+	for browsing := romPath == ""; ; romPath = "" {
+		if browsing {
+			var ok bool
+			if romPath, ok = runLauncher(); !ok {
+				return
+			}
+		}
+		err := startRom(romPath)
+		if err == nil {
+			break
+		}
+		if !browsing {
+			closeTermui()
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		window.SetTitle("GoChip-8 - " + err.Error())
+	}
+
+	if terminalMode {
+		runTerminal()
+	} else {
+		runWindow()
+	}
+}
+
+func startRom(romPath string) error {
+	//Loads a rom into a fresh cpu, used at start, from the rom browser and for roms dropped on the window. A rom that
+	//can't be read, like a folder or a recent rom that's since been deleted, leaves the one running alone
+	data, err := ioutil.ReadFile(romPath)
+	if err != nil {
+		return err
+	}
+	cpu = newCPU(romPath, data)
+	loadError = ""
+	selectPalette(romSettings(romPath, cpu.rom), cpu.rom)
+
+	setRomSpeed()
+
+	if watching {
+		if err := watchRom(romPath); err != nil {
+			appendInstruction(&instructionSlice, fmt.Sprintf("[watch error: %s](fg:red)\n", err))
+		}
+	}
+
+	addRecentRom(romPath)
+	setWindowTitle()
+	resetPresentation()
+	resetCoverage()
+	resetStats()
+	clearHistory()
+	frameCount = 0
+	redraw()
+	refreshDebugger()
+	return nil
+}
+
+func switchRom(romPath string) {
+	//Starts a rom picked while another is running, reporting in the title and the debugger if it couldn't be opened
+	if err := startRom(romPath); err != nil {
+		loadError = err.Error()
+		appendInstruction(&instructionSlice, fmt.Sprintf("[%s](fg:red)\n", err))
+		setWindowTitle()
+		refreshDebugger()
+		redraw()
+	}
+}
@@ -0,0 +1,269 @@
+package emulator
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+//pixelBuffer is an image in 0xRRGGBB colours, filters take the 64x32 display and return something bigger
+type pixelBuffer struct {
+	width  int
+	height int
+	pixels []uint32
+}
+
+func newPixelBuffer(width int, height int) pixelBuffer {
+	return pixelBuffer{width, height, make([]uint32, width*height)}
+}
+
+func (b pixelBuffer) at(x int, y int) uint32 {
+	//Pixels outside the buffer repeat the nearest edge
+	if x < 0 {
+		x = 0
+	} else if x >= b.width {
+		x = b.width - 1
+	}
+	if y < 0 {
+		y = 0
+	} else if y >= b.height {
+		y = b.height - 1
+	}
+	return b.pixels[y*b.width+x]
+}
+
+func (b pixelBuffer) set(x int, y int, color uint32) {
+	b.pixels[y*b.width+x] = color
+}
+
+//filter is a software post-processing effect applied to the display before it's uploaded
+type filter struct {
+	name  string
+	apply func(pixelBuffer) pixelBuffer
+}
+
+var filters = []filter{
+	{"none", func(b pixelBuffer) pixelBuffer { return b }},
+	{"scanlines", scanlines},
+	{"grid", pixelGrid},
+	{"scale2x", scale2x},
+	{"scale3x", scale3x},
+	{"crt", crt},
+}
+
+var filterIndex int = 0
+
+func activeFilter() filter {
+	return filters[filterIndex]
+}
+
+func selectFilter(name string) error {
+	for i, f := range filters {
+		if strings.EqualFold(f.name, name) {
+			filterIndex = i
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown filter %q", name)
+}
+
+func cycleFilter() {
+	filterIndex = (filterIndex + 1) % len(filters)
+}
+
+func frameBuffer(frame *[32][64]uint32) pixelBuffer {
+	b := newPixelBuffer(64, 32)
+	for y := 0; y < 32; y++ {
+		copy(b.pixels[y*64:], frame[y][:])
+	}
+	return b
+}
+
+func scaleColor(color uint32, amount float64) uint32 {
+	//Brightens or darkens a colour, clamping each channel
+	scale := func(shift uint) uint32 {
+		c := float64((color>>shift)&0xFF)*amount + 0.5
+		if c > 255 {
+			c = 255
+		}
+		return uint32(c) << shift
+	}
+	return scale(16) | scale(8) | scale(0)
+}
+
+func upscale(b pixelBuffer, factor int) pixelBuffer {
+	//Nearest neighbour scaling so the filters have room to work within each chip8 pixel
+	out := newPixelBuffer(b.width*factor, b.height*factor)
+	for y := 0; y < out.height; y++ {
+		for x := 0; x < out.width; x++ {
+			out.set(x, y, b.at(x/factor, y/factor))
+		}
+	}
+	return out
+}
+
+func scanlines(b pixelBuffer) pixelBuffer {
+	//Darkens the bottom third of every pixel row, like the gaps between a CRT's lines
+	out := upscale(b, 3)
+	for y := 2; y < out.height; y += 3 {
+		for x := 0; x < out.width; x++ {
+			out.set(x, y, scaleColor(out.at(x, y), 0.4))
+		}
+	}
+	return out
+}
+
+func pixelGrid(b pixelBuffer) pixelBuffer {
+	//Outlines every pixel, like the gaps between an LCD's cells
+	out := upscale(b, 4)
+	for y := 0; y < out.height; y++ {
+		for x := 0; x < out.width; x++ {
+			if x%4 == 3 || y%4 == 3 {
+				out.set(x, y, scaleColor(out.at(x, y), 0.6))
+			}
+		}
+	}
+	return out
+}
+
+func scale2x(b pixelBuffer) pixelBuffer {
+	//Scale2x (AdvMAME2x), smooths diagonal edges without blurring or adding colours
+	out := newPixelBuffer(b.width*2, b.height*2)
+	for y := 0; y < b.height; y++ {
+		for x := 0; x < b.width; x++ {
+			p := b.at(x, y)
+			up, left, right, down := b.at(x, y-1), b.at(x-1, y), b.at(x+1, y), b.at(x, y+1)
+
+			e0, e1, e2, e3 := p, p, p, p
+			if up != down && left != right {
+				if left == up {
+					e0 = left
+				}
+				if up == right {
+					e1 = right
+				}
+				if left == down {
+					e2 = left
+				}
+				if down == right {
+					e3 = right
+				}
+			}
+
+			out.set(x*2, y*2, e0)
+			out.set(x*2+1, y*2, e1)
+			out.set(x*2, y*2+1, e2)
+			out.set(x*2+1, y*2+1, e3)
+		}
+	}
+	return out
+}
+
+func scale3x(b pixelBuffer) pixelBuffer {
+	//Scale3x (AdvMAME3x), the same idea as Scale2x over a 3x3 block
+	out := newPixelBuffer(b.width*3, b.height*3)
+	for y := 0; y < b.height; y++ {
+		for x := 0; x < b.width; x++ {
+			//Neighbours are named left to right and top to bottom, e being the pixel itself
+			a, bb, c := b.at(x-1, y-1), b.at(x, y-1), b.at(x+1, y-1)
+			d, e, f := b.at(x-1, y), b.at(x, y), b.at(x+1, y)
+			g, h, i := b.at(x-1, y+1), b.at(x, y+1), b.at(x+1, y+1)
+
+			block := [9]uint32{e, e, e, e, e, e, e, e, e}
+			if bb != h && d != f {
+				if d == bb {
+					block[0] = d
+				}
+				if (d == bb && e != c) || (bb == f && e != a) {
+					block[1] = bb
+				}
+				if bb == f {
+					block[2] = f
+				}
+				if (d == bb && e != g) || (d == h && e != a) {
+					block[3] = d
+				}
+				if (bb == f && e != i) || (h == f && e != c) {
+					block[5] = f
+				}
+				if d == h {
+					block[6] = d
+				}
+				if (d == h && e != i) || (h == f && e != g) {
+					block[7] = h
+				}
+				if h == f {
+					block[8] = f
+				}
+			}
+
+			for n, color := range block {
+				out.set(x*3+n%3, y*3+n/3, color)
+			}
+		}
+	}
+	return out
+}
+
+func crt(b pixelBuffer) pixelBuffer {
+	//A rough CRT, scanlines with a glow around lit pixels, bent around a curved screen with darker corners
+	lines := upscale(b, 4)
+	for y := 3; y < lines.height; y += 4 {
+		for x := 0; x < lines.width; x++ {
+			lines.set(x, y, scaleColor(lines.at(x, y), 0.5))
+		}
+	}
+
+	//Bloom, a 5x5 box blur of the image added back on top of it
+	bloom := newPixelBuffer(lines.width, lines.height)
+	for y := 0; y < lines.height; y++ {
+		for x := 0; x < lines.width; x++ {
+			var r, g, bl uint32
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c := lines.at(x+dx, y+dy)
+					r += (c >> 16) & 0xFF
+					g += (c >> 8) & 0xFF
+					bl += c & 0xFF
+				}
+			}
+			bloom.set(x, y, (r/25)<<16|(g/25)<<8|bl/25)
+		}
+	}
+	for i, c := range lines.pixels {
+		glow := scaleColor(bloom.pixels[i], 0.35)
+		lines.pixels[i] = addColor(c, glow)
+	}
+
+	//Curvature, every output pixel looks up where it would have come from on a flat screen
+	out := newPixelBuffer(lines.width, lines.height)
+	const bend = 0.08
+	for y := 0; y < out.height; y++ {
+		for x := 0; x < out.width; x++ {
+			u := float64(x)/float64(out.width-1)*2 - 1
+			v := float64(y)/float64(out.height-1)*2 - 1
+			su := u * (1 + bend*v*v)
+			sv := v * (1 + bend*u*u)
+			if math.Abs(su) > 1 || math.Abs(sv) > 1 {
+				continue //Off the edge of the tube
+			}
+
+			sx := int((su + 1) / 2 * float64(lines.width-1))
+			sy := int((sv + 1) / 2 * float64(lines.height-1))
+			vignette := 1 - 0.25*(u*u*v*v)
+			out.set(x, y, scaleColor(lines.at(sx, sy), vignette))
+		}
+	}
+	return out
+}
+
+func addColor(a uint32, b uint32) uint32 {
+	add := func(shift uint) uint32 {
+		c := (a>>shift)&0xFF + (b>>shift)&0xFF
+		if c > 0xFF {
+			c = 0xFF
+		}
+		return c << shift
+	}
+	return add(16) | add(8) | add(0)
+}
@@ -0,0 +1,129 @@
+package emulator
+
+import (
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//go test ./emulator/ -run TestFilterGolden -update rewrites the golden images after a filter is changed on purpose
+var updateGolden = flag.Bool("update", false, "rewrite the golden images in testdata")
+
+func goldenInput() pixelBuffer {
+	//The font's glyphs across the top, a diagonal and a block in a third colour, for the filters to smooth and blur
+	const foreground, background, accent = 0xFFFFFF, 0x101820, 0x33AA55
+	b := newPixelBuffer(64, 32)
+	for i := range b.pixels {
+		b.pixels[i] = background
+	}
+	for glyph := 0; glyph < 16; glyph++ {
+		for row := 0; row < 5; row++ {
+			line := fontset[glyph*5+row]
+			for col := 0; col < 4; col++ {
+				if line&(0x80>>uint(col)) != 0 {
+					b.set(glyph%12*5+1+col, glyph/12*7+1+row, foreground)
+				}
+			}
+		}
+	}
+	for i := 0; i < 16; i++ {
+		b.set(2+i*2, 16+i, foreground)
+		b.set(3+i*2, 16+i, foreground)
+	}
+	for y := 18; y < 28; y++ {
+		for x := 40; x < 58; x++ {
+			if x+y < 80 || y%3 != 0 {
+				b.set(x, y, accent)
+			}
+		}
+	}
+	return b
+}
+
+func bufferImage(b pixelBuffer) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, b.width, b.height))
+	for y := 0; y < b.height; y++ {
+		for x := 0; x < b.width; x++ {
+			img.SetRGBA(x, y, rgb(b.at(x, y)))
+		}
+	}
+	return img
+}
+
+func TestFilterGolden(t *testing.T) {
+	tests := []struct {
+		filter        string
+		width, height int
+	}{
+		{"none", 64, 32},
+		{"scanlines", 192, 96},
+		{"grid", 256, 128},
+		{"scale2x", 128, 64},
+		{"scale3x", 192, 96},
+		{"crt", 256, 128},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			var apply func(pixelBuffer) pixelBuffer
+			for _, f := range filters {
+				if f.name == tt.filter {
+					apply = f.apply
+				}
+			}
+			if apply == nil {
+				t.Fatalf("no filter named %q", tt.filter)
+			}
+
+			got := bufferImage(apply(goldenInput()))
+			if got.Bounds().Dx() != tt.width || got.Bounds().Dy() != tt.height {
+				t.Fatalf("filtered to %dx%d, want %dx%d", got.Bounds().Dx(), got.Bounds().Dy(), tt.width, tt.height)
+			}
+
+			path := filepath.Join("testdata", "filter-"+tt.filter+".png")
+			if *updateGolden {
+				file, err := os.Create(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer file.Close()
+				if err := png.Encode(file, got); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatalf("%s, run with -update to create it", err)
+			}
+			defer file.Close()
+			golden, err := png.Decode(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if golden.Bounds() != got.Bounds() {
+				t.Fatalf("golden image is %v, filtered image is %v", golden.Bounds(), got.Bounds())
+			}
+
+			mismatched := 0
+			for y := 0; y < tt.height; y++ {
+				for x := 0; x < tt.width; x++ {
+					gr, gg, gb, _ := golden.At(x, y).RGBA()
+					r, g, b, _ := got.At(x, y).RGBA()
+					if gr != r || gg != g || gb != b {
+						if mismatched < 5 {
+							t.Errorf("pixel %d,%d is %02X%02X%02X, golden image has %02X%02X%02X", x, y, r>>8, g>>8, b>>8, gr>>8, gg>>8, gb>>8)
+						}
+						mismatched++
+					}
+				}
+			}
+			if mismatched > 0 {
+				t.Errorf("%d pixels differ from %s", mismatched, path)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package emulator
+
+import (
+	"strings"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+//textFont is a 3x5 pixel font in the same spirit as the chip8 fontset, used to draw text into the window
+//Each row uses the low three bits, with bit 2 being the leftmost pixel
+var textFont = map[rune][5]uint8{
+	'A': {2, 5, 7, 5, 5}, 'B': {6, 5, 6, 5, 6}, 'C': {3, 4, 4, 4, 3}, 'D': {6, 5, 5, 5, 6},
+	'E': {7, 4, 6, 4, 7}, 'F': {7, 4, 6, 4, 4}, 'G': {3, 4, 5, 5, 3}, 'H': {5, 5, 7, 5, 5},
+	'I': {7, 2, 2, 2, 7}, 'J': {1, 1, 1, 5, 2}, 'K': {5, 5, 6, 5, 5}, 'L': {4, 4, 4, 4, 7},
+	'M': {5, 7, 7, 5, 5}, 'N': {6, 5, 5, 5, 5}, 'O': {2, 5, 5, 5, 2}, 'P': {6, 5, 6, 4, 4},
+	'Q': {2, 5, 5, 6, 3}, 'R': {6, 5, 6, 5, 5}, 'S': {3, 4, 2, 1, 6}, 'T': {7, 2, 2, 2, 2},
+	'U': {5, 5, 5, 5, 7}, 'V': {5, 5, 5, 5, 2}, 'W': {5, 5, 7, 7, 5}, 'X': {5, 5, 2, 5, 5},
+	'Y': {5, 5, 2, 2, 2}, 'Z': {7, 1, 2, 4, 7},
+	'0': {7, 5, 5, 5, 7}, '1': {2, 6, 2, 2, 7}, '2': {6, 1, 2, 4, 7}, '3': {6, 1, 2, 1, 6},
+	'4': {5, 5, 7, 1, 1}, '5': {7, 4, 6, 1, 6}, '6': {3, 4, 6, 5, 2}, '7': {7, 1, 2, 2, 2},
+	'8': {2, 5, 2, 5, 2}, '9': {2, 5, 3, 1, 6},
+	' ': {0, 0, 0, 0, 0}, '.': {0, 0, 0, 0, 2}, ',': {0, 0, 0, 2, 4}, '-': {0, 0, 7, 0, 0},
+	'_': {0, 0, 0, 0, 7}, '(': {1, 2, 2, 2, 1}, ')': {4, 2, 2, 2, 4}, '/': {1, 1, 2, 4, 4},
+	':': {0, 2, 0, 2, 0}, '\'': {2, 2, 0, 0, 0}, '!': {2, 2, 2, 0, 2}, '?': {6, 1, 2, 0, 2},
+	'&': {2, 5, 2, 5, 3}, '+': {0, 2, 7, 2, 0}, '[': {3, 2, 2, 2, 3}, ']': {6, 2, 2, 2, 6},
+	'>': {4, 2, 1, 2, 4}, '#': {5, 7, 5, 7, 5}, '*': {5, 2, 7, 2, 5},
+}
+
+//textAdvance is how far along each character moves the next one, in font pixels
+var textAdvance int32 = 4
+
+func drawText(renderer *sdl.Renderer, text string, x int32, y int32, scale int32, color uint32) {
+	//Draws text in the 3x5 font, lower case is drawn as upper case and unknown characters as ?
+	setRenderColor(renderer, color)
+	for _, char := range strings.ToUpper(text) {
+		glyph, ok := textFont[char]
+		if !ok {
+			glyph = textFont['?']
+		}
+		for row := int32(0); row < 5; row++ {
+			for col := int32(0); col < 3; col++ {
+				if glyph[row]&(4>>uint(col)) != 0 {
+					pixel := sdl.Rect{X: x + col*scale, Y: y + row*scale, W: scale, H: scale}
+					renderer.FillRect(&pixel)
+				}
+			}
+		}
+		x += textAdvance * scale
+	}
+}
@@ -0,0 +1,110 @@
+package emulator
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+//headless runs the emulator without a window or debugger, for captures in scripts and CI
+var headless bool = false
+
+//Headless recordings are written to recordPath, they and the other captures other than screenshots last for recordFrames
+var recordPath string
+var recordFrames int = 600
+
+func setRomSpeed() {
+	//Uses the speed recommended by the rom database unless one was given on the command line
+	if !speedGiven {
+		speed = 600
+		if cpu.rom.tickrate > 0 {
+			speed = cpu.rom.tickrate * 60
+		}
+	}
+	limitSpeed(&speed)
+}
+
+func emulateFrame() {
+	//Runs a single 60hz frame as fast as possible: the timers tick once, then a frame's worth of instructions run
+	if cpu.delayTimer > 0 {
+		cpu.delayTimer--
+	}
+	if cpu.soundTimer > 0 {
+		cpu.soundTimer--
+	}
+
+	cpu.vblankWait = false
+	for i := 0; i < speed/60 && !cpu.vblankWait; i++ {
+		cpu.cycle()
+	}
+
+	captureFrame(&cpu.display)
+}
+
+func finishFrame() error {
+	//Everything that happens once a frame has been presented, whether there's a window or not
+	frameCount++
+	audio.queueFrame(cpu.soundTimer > 0)
+	if audioOut != nil {
+		audioOut.addFrame(cpu.soundTimer > 0)
+	}
+	if err := checkScheduledScreenshot(); err != nil {
+		return fmt.Errorf("screenshot failed: %s", err)
+	}
+	if err := recordFrame(); err != nil {
+		return fmt.Errorf("recording failed: %s", err)
+	}
+	return nil
+}
+
+func runHeadless(romPath string) error {
+	//Emulates frames without waiting between them until everything asked for on the command line has been captured
+	if romPath == "" {
+		return fmt.Errorf("a rom is needed to run headless")
+	}
+	if screenshotFrame == 0 && recordPath == "" && audioOut == nil && profiling == nil && coveragePath == "" && statsPath == "" {
+		return fmt.Errorf("nothing to capture, use --screenshot-at-frame, --record-gif, --audio-out, --profile, --coverage or --stats")
+	}
+
+	//A rom that can't be read fails the run, so scripts notice instead of capturing empty memory
+	data, err := ioutil.ReadFile(romPath)
+	if err != nil {
+		return err
+	}
+	//Nothing can step back without a debugger, so there's no need to keep history
+	historyLength = 0
+	cpu = newCPU(romPath, data)
+	selectPalette(romSettings(romPath, cpu.rom), cpu.rom)
+	setRomSpeed()
+	resetPresentation()
+	frameCount = 0
+
+	if recordPath != "" {
+		r, err := startRecording(recordPath)
+		if err != nil {
+			return err
+		}
+		recording = r
+	}
+
+	//Without a recording the rom only needs to run until the screenshot, otherwise it runs for the number of frames given
+	frames := screenshotFrame
+	if (recording != nil || audioOut != nil || profiling != nil || coveragePath != "" || statsPath != "") && recordFrames > frames {
+		frames = recordFrames
+	}
+	for frameCount < frames {
+		emulateFrame()
+		if err := finishFrame(); err != nil {
+			return err
+		}
+	}
+
+	if recording != nil {
+		if err := recording.stop(); err != nil {
+			return err
+		}
+	}
+	if audioOut != nil {
+		return audioOut.save()
+	}
+	return nil
+}
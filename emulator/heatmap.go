@@ -0,0 +1,101 @@
+package emulator
+
+import (
+	"image"
+	"math"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+//The heatmap shows the 4k of memory as 64x64 squares, 64 addresses to a row. Instructions run light it up green,
+//reads blue and writes red, brighter the more often it happened
+var heatmapShown bool = false
+
+//Addresses nothing has touched, dimmer outside the rom
+var heatmapRomColor uint32 = 0x303030
+var heatmapEmptyColor uint32 = 0x141414
+
+//heatmapPane draws the heatmap in the debugger with halfblocks, two addresses to a cell
+var heatmapPane *heatmapWidget
+
+type heatmapWidget struct {
+	ui.Block
+}
+
+func newHeatmapPane(top int) *heatmapWidget {
+	pane := &heatmapWidget{Block: *ui.NewBlock()}
+	pane.Title = "Heatmap - exec green, read blue, write red"
+	pane.BorderStyle.Fg = ui.ColorGreen
+	pane.SetRect(1, top, 64+3, top+32+2)
+	return pane
+}
+
+func heatLevel(count uint64, max uint64) uint32 {
+	//Counts vary by orders of magnitude so the brightness follows their log, anything touched at all is visible
+	if count == 0 || max == 0 {
+		return 0
+	}
+	return uint32(64 + 191*math.Log1p(float64(count))/math.Log1p(float64(max)))
+}
+
+func heatmapBuffer() pixelBuffer {
+	var maxExec, maxRead, maxWrite uint64
+	for addr := 0; addr < 0x1000; addr++ {
+		if coverage.exec[addr] > maxExec {
+			maxExec = coverage.exec[addr]
+		}
+		if coverage.read[addr] > maxRead {
+			maxRead = coverage.read[addr]
+		}
+		if coverage.write[addr] > maxWrite {
+			maxWrite = coverage.write[addr]
+		}
+	}
+
+	//Both bytes of an instruction are lit with the count of its first
+	romEnd := 0x200 + len(cpu.romData)
+	b := newPixelBuffer(64, 64)
+	for addr := 0; addr < 0x1000; addr++ {
+		exec := coverage.exec[addr]
+		if addr > 0 && coverage.exec[addr-1] > exec {
+			exec = coverage.exec[addr-1]
+		}
+		color := heatLevel(coverage.write[addr], maxWrite)<<16 | heatLevel(exec, maxExec)<<8 | heatLevel(coverage.read[addr], maxRead)
+		if color == 0 {
+			color = heatmapEmptyColor
+			if addr >= 0x200 && addr < romEnd {
+				color = heatmapRomColor
+			}
+		}
+		b.pixels[addr] = color
+	}
+	return b
+}
+
+func heatmapRect() sdl.Rect {
+	//A square the height of the display, in the middle of where the display goes
+	display := displayRect()
+	return sdl.Rect{X: display.X + (display.W-display.H)/2, Y: display.Y, W: display.H, H: display.H}
+}
+
+func (h *heatmapWidget) Draw(buf *ui.Buffer) {
+	h.Block.Draw(buf)
+	b := heatmapBuffer()
+	for row := 0; row < 32; row++ {
+		for col := 0; col < 64; col++ {
+			style := ui.NewStyle(xtermColor(b.at(col, row*2)), xtermColor(b.at(col, row*2+1)))
+			buf.SetCell(ui.NewCell('▀', style), image.Pt(h.Inner.Min.X+col, h.Inner.Min.Y+row))
+		}
+	}
+}
+
+func toggleHeatmap() {
+	//Swaps the display for the heatmap in the window, and opens the heatmap pane in the debugger
+	heatmapShown = !heatmapShown
+	if termuiOpen {
+		ui.Clear()
+		terminalDirty = true
+	}
+	redraw()
+}
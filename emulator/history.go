@@ -0,0 +1,314 @@
+package emulator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+//History lets the debugger step backwards. Every instruction records what it's about to change, so it can be undone,
+//and every snapshotInterval instructions the whole machine is copied so jumping far back doesn't undo every step
+var historyLength int = 60000 //Instructions kept, 0 turns history off
+var snapshotInterval uint64 = 1000
+
+//historyDelta is the machine as it was before an instruction, apart from memory and the display which are only kept
+//when the instruction changed them
+type historyDelta struct {
+	cycles     uint64 //cpu.cycles before the instruction ran
+	pc         uint16
+	index      uint16
+	V          [16]uint8
+	stack      [16]uint16
+	stkptr     uint8
+	delayTimer uint8
+	soundTimer uint8
+	keyWait    bool
+	vblankWait bool
+	writes     []historyWrite
+	rows       []historyRow //Rows of the display a CLS or DRW was about to change
+}
+
+//historyRow is a row of the display as it was before an instruction drew on it or cleared it
+type historyRow struct {
+	y      uint8
+	pixels [64]uint8
+}
+
+//historyWrite is a byte of memory as it was before the rom wrote to it
+type historyWrite struct {
+	addr      uint16
+	value     uint8
+	lastWrite uint64
+}
+
+//machineState is everything about the cpu that running instructions changes, keys and settings aren't part of it
+type machineState struct {
+	V          [16]uint8
+	memory     [4096]uint8
+	stack      [16]uint16
+	display    [32][64]uint8
+	pc         uint16
+	index      uint16
+	stkptr     uint8
+	delayTimer uint8
+	soundTimer uint8
+	keyWait    bool
+	vblankWait bool
+	cycles     uint64
+	lastWrite  [4096]uint64
+}
+
+//historySnapshot is the machine as it was before the instruction at cycles ran
+type historySnapshot struct {
+	cycles  uint64
+	machine *machineState
+}
+
+var historyDeltas []historyDelta
+var historySnapshots []historySnapshot
+
+//History pane, shows how far back the debugger can go and takes a cycle number to jump to
+var historyPane *widgets.Paragraph
+var historyGoto string
+var historyGotoActive bool = false
+var historyMessage string
+
+func (c *CPU) saveMachine() *machineState {
+	return &machineState{c.V, c.memory, c.stack, c.display, c.pc, c.index, c.stkptr, c.delayTimer, c.soundTimer,
+		c.keyWait, c.vblankWait, c.cycles, c.lastWrite}
+}
+
+func (c *CPU) loadMachine(m *machineState) {
+	c.V, c.memory, c.stack, c.display = m.V, m.memory, m.stack, m.display
+	c.pc, c.index, c.stkptr = m.pc, m.index, m.stkptr
+	c.delayTimer, c.soundTimer = m.delayTimer, m.soundTimer
+	c.keyWait, c.vblankWait = m.keyWait, m.vblankWait
+	c.cycles, c.lastWrite = m.cycles, m.lastWrite
+	c.opcode = c.opcodeAt(c.pc)
+}
+
+func clearHistory() {
+	historyDeltas, historySnapshots = nil, nil
+}
+
+func recordHistory(c *CPU) {
+	//Called before each instruction runs, with its opcode fetched
+	if historyLength <= 0 {
+		return
+	}
+	if c.cycles%snapshotInterval == 0 {
+		historySnapshots = append(historySnapshots, historySnapshot{c.cycles, c.saveMachine()})
+	}
+
+	delta := historyDelta{
+		cycles: c.cycles, pc: c.pc, index: c.index, V: c.V, stack: c.stack, stkptr: c.stkptr,
+		delayTimer: c.delayTimer, soundTimer: c.soundTimer, keyWait: c.keyWait, vblankWait: c.vblankWait,
+	}
+	if c.opcode == 0x00E0 {
+		//A clear only changes the rows with something on them
+		for y, row := range c.display {
+			if row != [64]uint8{} {
+				delta.rows = append(delta.rows, historyRow{uint8(y), row})
+			}
+		}
+	} else if c.opcode>>12 == 0xD {
+		//A sprite is n rows down from Vy, kept as if it wraps as those are the only rows it can touch either way
+		top := int(c.V[c.opcode>>4&0xF] % 32)
+		for i := 0; i < int(c.opcode&0xF); i++ {
+			y := (top + i) % 32
+			delta.rows = append(delta.rows, historyRow{uint8(y), c.display[y]})
+		}
+	}
+	historyDeltas = append(historyDeltas, delta)
+
+	//Forget the oldest a snapshot's worth at a time, along with the snapshots that can't be reached any more
+	if len(historyDeltas) > historyLength+int(snapshotInterval) {
+		historyDeltas = historyDeltas[len(historyDeltas)-historyLength:]
+		oldest := historyDeltas[0].cycles
+		for len(historySnapshots) > 0 && historySnapshots[0].cycles < oldest {
+			historySnapshots = historySnapshots[1:]
+		}
+	}
+}
+
+func noteHistoryWrite(addr uint16, value uint8, lastWrite uint64) {
+	//Called by writeMemory before a byte changes, the write belongs to the instruction running
+	if historyLength <= 0 || len(historyDeltas) == 0 {
+		return
+	}
+	delta := &historyDeltas[len(historyDeltas)-1]
+	delta.writes = append(delta.writes, historyWrite{addr, value, lastWrite})
+}
+
+func oldestCycle() uint64 {
+	if len(historyDeltas) == 0 {
+		return cpu.cycles
+	}
+	return historyDeltas[0].cycles
+}
+
+func undoInstruction() bool {
+	//Puts the machine back to before the last instruction ran, returning false if there's no history left
+	if len(historyDeltas) == 0 {
+		return false
+	}
+	d := &historyDeltas[len(historyDeltas)-1]
+	for i := len(d.writes) - 1; i >= 0; i-- {
+		w := d.writes[i]
+		cpu.memory[w.addr] = w.value
+		cpu.lastWrite[w.addr] = w.lastWrite
+	}
+	for _, row := range d.rows {
+		cpu.display[row.y] = row.pixels
+	}
+	cpu.pc, cpu.index, cpu.V, cpu.stack, cpu.stkptr = d.pc, d.index, d.V, d.stack, d.stkptr
+	cpu.delayTimer, cpu.soundTimer = d.delayTimer, d.soundTimer
+	cpu.keyWait, cpu.vblankWait = d.keyWait, d.vblankWait
+	cpu.cycles = d.cycles
+	cpu.opcode = cpu.opcodeAt(cpu.pc)
+	historyDeltas = historyDeltas[:len(historyDeltas)-1]
+
+	//A snapshot taken at this cycle is still good, anything later is in the undone future
+	for len(historySnapshots) > 0 && historySnapshots[len(historySnapshots)-1].cycles > cpu.cycles {
+		historySnapshots = historySnapshots[:len(historySnapshots)-1]
+	}
+	return true
+}
+
+func (d *historyDelta) hitsWatchpoint() (uint16, bool) {
+	//Returns the watched address the instruction wrote to, if it wrote to one
+	for _, w := range d.writes {
+		if watchpoints[w.addr] {
+			return w.addr, true
+		}
+	}
+	return 0, false
+}
+
+func jumpToCycle(target uint64) error {
+	//Goes back to before the instruction at cycle target ran, starting from the nearest snapshot past it
+	if target >= cpu.cycles {
+		return fmt.Errorf("cycle %d isn't in the past, the cpu is on %d", target, cpu.cycles)
+	}
+	if target < oldestCycle() {
+		return fmt.Errorf("cycle %d is too far back, history goes back to %d", target, oldestCycle())
+	}
+
+	for i, snapshot := range historySnapshots {
+		if snapshot.cycles >= target {
+			cpu.loadMachine(snapshot.machine)
+			historyDeltas = historyDeltas[:snapshot.cycles-historyDeltas[0].cycles]
+			historySnapshots = historySnapshots[:i+1]
+			break
+		}
+	}
+	for cpu.cycles > target && undoInstruction() {
+	}
+	return nil
+}
+
+func reverseContinue() string {
+	//Steps back until the pc is on a breakpoint, or until just after an instruction that wrote to a watchpoint
+	for undone := 0; ; undone++ {
+		if len(historyDeltas) == 0 {
+			if undone == 0 {
+				return "no history to go back through"
+			}
+			return "reached the start of history"
+		}
+		last := &historyDeltas[len(historyDeltas)-1]
+		if addr, hit := last.hitsWatchpoint(); undone > 0 && hit {
+			return fmt.Sprintf("watchpoint %03X written at %03X", addr, last.pc)
+		}
+		undoInstruction()
+		if breakpoints[cpu.pc] {
+			return fmt.Sprintf("breakpoint at %03X", cpu.pc)
+		}
+	}
+}
+
+func afterRewind(message string) {
+	//Going back always leaves the debugger in stepmode, so it can be stepped forward again from there
+	stepMode = 1
+	historyMessage = message
+	appendInstruction(&instructionSlice, fmt.Sprintf("[--- %s, cycle %d ---](fg:red)\n", message, cpu.cycles))
+	captureFrame(&cpu.display)
+	redraw()
+	refreshDebugger()
+}
+
+func stepBack() {
+	if undoInstruction() {
+		afterRewind("stepped back")
+	} else {
+		afterRewind("no history to go back through")
+	}
+}
+
+func reverseToBreak() {
+	afterRewind(reverseContinue())
+}
+
+func initHistoryPane(top int) *widgets.Paragraph {
+	pane := widgets.NewParagraph()
+	pane.Title = "History"
+	pane.BorderStyle.Fg = ui.ColorRed
+	pane.SetRect(68, top, 119, top+8)
+	return pane
+}
+
+func updateHistoryPane() {
+	lines := []string{
+		fmt.Sprintf("[Cycle](fg:yellow) %d  [back to](fg:yellow) %d", cpu.cycles, oldestCycle()),
+		fmt.Sprintf("[Kept](fg:yellow) %d instructions, %d snapshots", len(historyDeltas), len(historySnapshots)),
+		"b back  r reverse continue  g go to cycle",
+	}
+	if historyLength <= 0 {
+		lines = []string{"History is off"}
+	}
+	if historyGotoActive {
+		lines = append(lines, fmt.Sprintf("[Go to cycle](fg:yellow) %s_", historyGoto))
+	} else if historyMessage != "" {
+		lines = append(lines, historyMessage)
+	}
+	historyPane.Text = strings.Join(lines, "\n")
+}
+
+func handleHistoryKey(id string) bool {
+	//b steps back, r reverse continues and g takes a cycle number to go back to. Returns whether the key was used
+	if historyGotoActive {
+		switch {
+		case id == "<Enter>":
+			historyGotoActive = false
+			if target, err := strconv.ParseUint(historyGoto, 10, 64); err == nil {
+				if err := jumpToCycle(target); err != nil {
+					historyMessage = err.Error()
+				} else {
+					afterRewind("went back")
+				}
+			}
+		case id == "<Escape>":
+			historyGotoActive = false
+		case id == "<Backspace>" && len(historyGoto) > 0:
+			historyGoto = historyGoto[:len(historyGoto)-1]
+		case len(id) == 1 && id[0] >= '0' && id[0] <= '9' && len(historyGoto) < 19:
+			historyGoto += id
+		}
+		return true
+	}
+
+	switch id {
+	case "b":
+		stepBack()
+	case "r":
+		reverseToBreak()
+	case "g":
+		historyGotoActive, historyGoto = true, ""
+	default:
+		return false
+	}
+	return true
+}
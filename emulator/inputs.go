@@ -0,0 +1,80 @@
+package emulator
+
+import (
+	"fmt"
+	"strings"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+//Keys and timers pane, what the cpu thinks is held down and how long the timers have left
+var inputPane *widgets.Paragraph
+
+//timerBarWidth is the width of the DT and ST bars, a full bar is 255
+var timerBarWidth int = 18
+
+//Partial blocks let the bars move in eighths of a character
+var barEighths = []string{"", "▏", "▎", "▍", "▌", "▋", "▊", "▉"}
+
+func initInputPane(top int) *widgets.Paragraph {
+	pane := widgets.NewParagraph()
+	pane.Title = "Keys and timers"
+	pane.BorderStyle.Fg = ui.ColorMagenta
+	pane.SetRect(120, top, 148, top+16)
+	return pane
+}
+
+func timerBar(value uint8) string {
+	eighths := int(value) * timerBarWidth * 8 / 255
+	if value > 0 && eighths == 0 {
+		eighths = 1
+	}
+	return strings.Repeat("█", eighths/8) + barEighths[eighths%8]
+}
+
+func updateInputPane() {
+	lines := make([]string, 0)
+
+	//The keypad as it's laid out on the cosmac vip
+	for row := 0; row < 4; row++ {
+		keys := make([]string, 0, 4)
+		for _, key := range keypadOrder[row*4 : row*4+4] {
+			if cpu.keyInputs[key] {
+				keys = append(keys, fmt.Sprintf("[ %X ](fg:black,bg:green)", key))
+			} else {
+				keys = append(keys, fmt.Sprintf(" %X ", key))
+			}
+		}
+		lines = append(lines, " "+strings.Join(keys, " "))
+	}
+	lines = append(lines, "")
+
+	if last := cpu.lastKey; last.source != "" {
+		state := "up"
+		if last.pressed {
+			state = "down"
+		}
+		lines = append(lines, fmt.Sprintf("[Last](fg:yellow): %X %s", last.key, state))
+		lines = append(lines, fmt.Sprintf("  %s, %d cycles ago", last.source, cpu.cycles-last.cycle))
+	} else {
+		lines = append(lines, "[Last](fg:yellow): none", "")
+	}
+
+	//Fx0A leaves the pc on itself while it waits, so the register comes from the opcode there
+	if cpu.keyWait {
+		x := cpu.memory[cpu.pc] & 0xF
+		lines = append(lines, fmt.Sprintf("[Waiting](fg:yellow): [LD V%X K at %03X](fg:red)", x, cpu.pc))
+	} else {
+		lines = append(lines, "[Waiting](fg:yellow): no")
+	}
+	lines = append(lines, "")
+
+	lines = append(lines, fmt.Sprintf("[DT](fg:green) %3d [%s](fg:cyan)", cpu.delayTimer, timerBar(cpu.delayTimer)))
+	lines = append(lines, fmt.Sprintf("[ST](fg:green) %3d [%s](fg:red)", cpu.soundTimer, timerBar(cpu.soundTimer)))
+	if cpu.soundTimer > 0 {
+		lines = append(lines, "   buzzing")
+	}
+
+	inputPane.Text = strings.Join(lines, "\n")
+}
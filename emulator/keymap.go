@@ -0,0 +1,203 @@
+package emulator
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+//keypadOrder is the chip8 keypad read left to right, top to bottom
+var keypadOrder = [16]uint8{
+	0x1, 0x2, 0x3, 0xC,
+	0x4, 0x5, 0x6, 0xD,
+	0x7, 0x8, 0x9, 0xE,
+	0xA, 0x0, 0xB, 0xF,
+}
+
+//layouts place the keypad onto a 4x4 block of keys, listed in keypadOrder
+var layouts = map[string][16]string{
+	"qwerty": {
+		"1", "2", "3", "4",
+		"Q", "W", "E", "R",
+		"A", "S", "D", "F",
+		"Z", "X", "C", "V",
+	},
+	"azerty": {
+		"1", "2", "3", "4",
+		"A", "Z", "E", "R",
+		"Q", "S", "D", "F",
+		"W", "X", "C", "V",
+	},
+	"dvorak": {
+		"1", "2", "3", "4",
+		"'", ",", ".", "P",
+		"A", "O", "E", "U",
+		";", "Q", "J", "K",
+	},
+	"numpad": {
+		"Keypad 7", "Keypad 8", "Keypad 9", "Keypad /",
+		"Keypad 4", "Keypad 5", "Keypad 6", "Keypad *",
+		"Keypad 1", "Keypad 2", "Keypad 3", "Keypad -",
+		"Keypad 0", "Keypad .", "Keypad Enter", "Keypad +",
+	},
+}
+
+//Actions that can be bound to hotkeys
+const (
+	actionPause      = "pause"
+	actionStep       = "step"
+	actionStepOnce   = "stepOnce"
+	actionSpeedDown  = "speedDown"
+	actionSpeedUp    = "speedUp"
+	actionReset      = "reset"
+	actionReload     = "reload"
+	actionBreakpoint = "breakpoint"
+	actionScreenshot = "screenshot"
+	actionKeypad     = "keypad"
+	actionLauncher   = "launcher"
+	actionPalette    = "palette"
+	actionFullscreen = "fullscreen"
+	actionPresent    = "present"
+	actionFilter     = "filter"
+	actionRecord     = "record"
+	actionMute       = "mute"
+	actionDebugger   = "debugger"
+	actionHeatmap    = "heatmap"
+	actionStepBack   = "stepBack"
+	actionReverse    = "reverseContinue"
+)
+
+//defaultHotkeys are used for any action not bound in the config
+var defaultHotkeys = map[string]string{
+	actionPause:      "P",
+	actionStep:       "I",
+	actionStepOnce:   "O",
+	actionSpeedDown:  "[",
+	actionSpeedUp:    "]",
+	actionReset:      "F5",
+	actionReload:     "F6",
+	actionBreakpoint: "B",
+	actionScreenshot: "F12",
+	actionKeypad:     "F1",
+	actionLauncher:   "F2",
+	actionPalette:    "F3",
+	actionFullscreen: "F11",
+	actionPresent:    "F4",
+	actionFilter:     "F7",
+	actionRecord:     "F8",
+	actionMute:       "F9",
+	actionDebugger:   "F10",
+	actionHeatmap:    "H",
+	actionStepBack:   "N",
+	actionReverse:    "M",
+}
+
+//hotkeys maps keys to the emulator action they trigger, configuredHotkeys are the ones bound in the config
+var hotkeys map[sdl.Keycode]string
+var configuredHotkeys map[sdl.Keycode]bool
+
+func keyFromName(name string) (sdl.Keycode, bool) {
+	key := sdl.GetKeyFromName(name)
+	if key == sdl.K_UNKNOWN {
+		fmt.Printf("unknown key name %q\n", name)
+		return key, false
+	}
+	return key, true
+}
+
+func buildKeyMap(conf romConfig) map[sdl.Keycode]uint8 {
+	//Builds the keymap from the layout, then the config bindings and finally the rom's own bindings
+	layoutName := settings.Layout
+	if conf.Layout != "" {
+		layoutName = conf.Layout
+	}
+	layout, ok := layouts[layoutName]
+	if !ok {
+		if layoutName != "" {
+			fmt.Printf("unknown layout %q, using qwerty\n", layoutName)
+		}
+		layout = layouts["qwerty"]
+	}
+
+	keyMap := make(map[sdl.Keycode]uint8)
+	for i, name := range layout {
+		if key, ok := keyFromName(name); ok {
+			keyMap[key] = keypadOrder[i]
+		}
+	}
+
+	for _, bindings := range []map[string]int{settings.Keys, conf.Keys} {
+		for name, value := range bindings {
+			if value < 0 || value > 0xF {
+				fmt.Printf("key %q is bound to %X which isn't a chip8 key\n", name, value)
+				continue
+			}
+			if key, ok := keyFromName(name); ok {
+				keyMap[key] = uint8(value)
+			}
+		}
+	}
+
+	return keyMap
+}
+
+func buildHotkeys() map[sdl.Keycode]string {
+	//Binds every action to the key from the config, or its default. Actions go in alphabetical order so a clash always
+	//ends the same way, and a key from the config takes it from any action that only has it by default
+	actions := make([]string, 0, len(defaultHotkeys))
+	for action := range defaultHotkeys {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+
+	keys := make(map[sdl.Keycode]string)
+	configuredHotkeys = make(map[sdl.Keycode]bool)
+	for _, action := range actions {
+		if _, isConfigured := settings.Hotkeys[action]; isConfigured {
+			continue
+		}
+		if key, ok := keyFromName(defaultHotkeys[action]); ok {
+			keys[key] = action
+		}
+	}
+	for _, action := range actions {
+		name, isConfigured := settings.Hotkeys[action]
+		if !isConfigured {
+			continue
+		}
+		key, ok := keyFromName(name)
+		if !ok {
+			continue
+		}
+		if other, taken := keys[key]; taken && configuredHotkeys[key] {
+			fmt.Printf("hotkey %q is bound to both %s and %s, using %s\n", name, other, action, other)
+			continue
+		} else if taken {
+			fmt.Printf("hotkey %q for %s is %s's default, %s has no key\n", name, action, other, other)
+		}
+		keys[key] = action
+		configuredHotkeys[key] = true
+	}
+
+	for action := range settings.Hotkeys {
+		if _, ok := defaultHotkeys[action]; !ok {
+			fmt.Printf("unknown hotkey action %q\n", action)
+		}
+	}
+
+	return keys
+}
+
+func hotkeyAction(key sdl.Keycode) (string, bool) {
+	//Finds the action for a key pressed over the game. The rom's keypad wins over a default hotkey on the same key, so
+	//layouts like dvorak that put the keypad on P and O can reach every key, while hotkeys from the config always win
+	action, ok := hotkeys[key]
+	if !ok || configuredHotkeys[key] || cpu == nil {
+		return action, ok
+	}
+	if _, onKeypad := cpu.keyMap[key]; onKeypad {
+		return "", false
+	}
+	return action, true
+}
@@ -0,0 +1,137 @@
+package emulator
+
+import (
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+//On-screen keypad drawn beneath the display, for when there's no keyboard to hand
+var keypadShown bool = false
+var keypadRowHeight int32 = 60
+var keypadFontScale int32 = 8
+
+//Keys held down on the keypad by the mouse and by each finger touching the screen
+var mouseKey int = -1
+var fingerKeys = make(map[sdl.FingerID]uint8)
+
+func keypadHeight() int32 {
+	//Height the keypad takes up at the bottom of the window
+	if keypadShown {
+		return keypadRowHeight * 4
+	}
+	return 0
+}
+
+func toggleKeypad() {
+	//Grows the window to make room for the keypad, unless it's fullscreen and the display has to shrink instead
+	keypadShown = !keypadShown
+	if !keypadShown {
+		releaseKeypad()
+	}
+	if !isFullscreen() {
+		w, h := window.GetSize()
+		if keypadShown {
+			window.SetSize(w, h+keypadRowHeight*4)
+		} else {
+			window.SetSize(w, h-keypadRowHeight*4)
+		}
+	}
+	drawFromArray(window, surface, renderer, &cpu.display)
+}
+
+func releaseKeypad() {
+	//Lets go of keys held on the keypad, so hiding it doesn't leave them stuck down
+	if mouseKey != -1 {
+		cpu.setKey(uint8(mouseKey), false, "keypad")
+		mouseKey = -1
+	}
+	for finger, key := range fingerKeys {
+		cpu.setKey(key, false, "touch")
+		delete(fingerKeys, finger)
+	}
+}
+
+func drawKeypad(renderer *sdl.Renderer) {
+	//Draws the 4x4 keypad, highlighting keys that are held down
+	w, top := displayArea()
+	cellWidth := w / 4
+
+	for i, key := range keypadOrder {
+		cell := sdl.Rect{X: int32(i%4) * cellWidth, Y: top + int32(i/4)*keypadRowHeight, W: cellWidth, H: keypadRowHeight}
+
+		background, foreground := activePalette().background(), activePalette().foreground()
+		if cpu.keyInputs[key] {
+			background, foreground = foreground, background
+		}
+
+		setRenderColor(renderer, activePalette().border)
+		renderer.FillRect(&cell)
+		setRenderColor(renderer, background)
+		inner := sdl.Rect{X: cell.X + perim/2, Y: cell.Y + perim/2, W: cell.W - perim, H: cell.H - perim}
+		if inner.W < 0 {
+			inner.W = 0
+		}
+		renderer.FillRect(&inner)
+
+		//Label the key with its glyph from the chip8 font, centered in the cell
+		setRenderColor(renderer, foreground)
+		glyphX := cell.X + (cell.W-4*keypadFontScale)/2
+		glyphY := cell.Y + (cell.H-5*keypadFontScale)/2
+		for row := int32(0); row < 5; row++ {
+			line := fontset[int32(key)*5+row]
+			for col := int32(0); col < 4; col++ {
+				if line&(0x80>>uint(col)) != 0 {
+					pixel := sdl.Rect{X: glyphX + col*keypadFontScale, Y: glyphY + row*keypadFontScale, W: keypadFontScale, H: keypadFontScale}
+					renderer.FillRect(&pixel)
+				}
+			}
+		}
+	}
+}
+
+func keypadKeyAt(x int32, y int32) (uint8, bool) {
+	//Returns the keypad key at a point in the window
+	w, top := displayArea()
+	if !keypadShown || y < top || y >= top+keypadHeight() || x < 0 || x >= w || w < 4 {
+		return 0, false
+	}
+	col := x / (w / 4)
+	row := (y - top) / keypadRowHeight
+	if col > 3 {
+		col = 3
+	}
+	return keypadOrder[row*4+col], true
+}
+
+func handleKeypadEvent(event sdl.Event) {
+	//Presses keypad keys with the mouse or touch, each finger holding its own key
+	switch e := event.(type) {
+	case *sdl.MouseButtonEvent:
+		//Touches also arrive as mouse events, those are handled as fingers instead
+		if e.Which == sdl.TOUCH_MOUSEID || e.Button != sdl.BUTTON_LEFT {
+			return
+		}
+		if e.Type == sdl.MOUSEBUTTONDOWN {
+			if key, ok := keypadKeyAt(e.X, e.Y); ok {
+				mouseKey = int(key)
+				cpu.setKey(key, true, "keypad")
+			}
+		} else if e.Type == sdl.MOUSEBUTTONUP && mouseKey != -1 {
+			cpu.setKey(uint8(mouseKey), false, "keypad")
+			mouseKey = -1
+		}
+	case *sdl.TouchFingerEvent:
+		//Finger positions are normalised to the window size
+		w, h := window.GetSize()
+		if e.Type == sdl.FINGERDOWN {
+			if key, ok := keypadKeyAt(int32(e.X*float32(w)), int32(e.Y*float32(h))); ok {
+				fingerKeys[e.FingerID] = key
+				cpu.setKey(key, true, "touch")
+			}
+		} else if e.Type == sdl.FINGERUP {
+			if key, ok := fingerKeys[e.FingerID]; ok {
+				cpu.setKey(key, false, "touch")
+				delete(fingerKeys, e.FingerID)
+			}
+		}
+	}
+}
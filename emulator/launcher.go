@@ -0,0 +1,215 @@
+package emulator
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+//launcherEntry is a row in the rom browser
+type launcherEntry struct {
+	label  string
+	path   string
+	isDir  bool
+	header bool //Headers only label the rows beneath them and can't be selected
+}
+
+//Directory the rom browser is showing, set from the config
+var romDir string = "roms"
+
+//Rom browser layout, in window pixels
+var launcherMargin int32 = 20
+var launcherTextScale int32 = 4
+var launcherLineHeight int32 = 28
+
+func romLabel(romPath string) string {
+	//Labels a rom with its title from the database, or its file name if it isn't known
+	data, err := ioutil.ReadFile(romPath)
+	if err == nil {
+		if info := lookupRom(data); info.known {
+			return info.program.Title
+		}
+	}
+	return filepath.Base(romPath)
+}
+
+func listLauncherEntries(dir string) []launcherEntry {
+	//Lists the recently played roms followed by the contents of dir
+	entries := make([]launcherEntry, 0)
+
+	if len(recentRoms) > 0 {
+		entries = append(entries, launcherEntry{label: "-- recent --", header: true})
+		for _, romPath := range recentRoms {
+			entries = append(entries, launcherEntry{label: romLabel(romPath), path: romPath})
+		}
+	}
+
+	entries = append(entries, launcherEntry{label: "-- " + dir + " --", header: true})
+	entries = append(entries, launcherEntry{label: "../", path: filepath.Dir(filepath.Clean(dir)), isDir: true})
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		entries = append(entries, launcherEntry{label: err.Error(), header: true})
+		return entries
+	}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		filePath := filepath.Join(dir, file.Name())
+		if file.IsDir() {
+			entries = append(entries, launcherEntry{label: file.Name() + "/", path: filePath, isDir: true})
+		} else {
+			entries = append(entries, launcherEntry{label: romLabel(filePath), path: filePath})
+		}
+	}
+
+	return entries
+}
+
+func nextSelectable(entries []launcherEntry, from int, direction int) int {
+	//Finds the next entry that isn't a header, staying put if there isn't one
+	for i := from + direction; i >= 0 && i < len(entries); i += direction {
+		if !entries[i].header {
+			return i
+		}
+	}
+	return from
+}
+
+func launcherRows() int {
+	_, h := window.GetSize()
+	return int((h - launcherMargin*2) / launcherLineHeight)
+}
+
+func drawLauncher(entries []launcherEntry, selected int, scroll int) {
+	renderer.Clear()
+	setRenderColor(renderer, activePalette().background())
+	renderer.FillRect(nil)
+
+	w, _ := window.GetSize()
+	maxChars := int((w - launcherMargin*2) / (textAdvance * launcherTextScale))
+	for row := 0; row < launcherRows() && scroll+row < len(entries); row++ {
+		entry := entries[scroll+row]
+		y := launcherMargin + int32(row)*launcherLineHeight
+
+		//drawText advances a glyph per rune, so titles are cut by rune rather than splitting one
+		label := []rune(entry.label)
+		if len(label) > maxChars && maxChars >= 0 {
+			label = label[:maxChars]
+		}
+
+		color := activePalette().foreground()
+		if scroll+row == selected {
+			highlight := sdl.Rect{X: launcherMargin / 2, Y: y - 4, W: w - launcherMargin, H: launcherLineHeight}
+			setRenderColor(renderer, color)
+			renderer.FillRect(&highlight)
+			color = activePalette().background()
+		}
+		drawText(renderer, string(label), launcherMargin, y, launcherTextScale, color)
+	}
+
+	renderer.Present()
+}
+
+func runLauncher() (string, bool) {
+	//Shows the rom browser until a rom is picked or dropped on the window. Returns false if it was closed instead
+	entries := listLauncherEntries(romDir)
+	selected := nextSelectable(entries, -1, 1)
+	scroll := 0
+
+	browse := func(dir string) {
+		romDir = dir
+		entries = listLauncherEntries(romDir)
+		selected = nextSelectable(entries, -1, 1)
+		scroll = 0
+	}
+	open := func() (string, bool) {
+		entry := entries[selected]
+		if !entry.isDir {
+			return entry.path, true
+		}
+		browse(entry.path)
+		return "", false
+	}
+
+	for running {
+		//Keep the selection on screen
+		if selected < scroll {
+			scroll = selected
+		} else if selected >= scroll+launcherRows() {
+			scroll = selected - launcherRows() + 1
+		}
+		drawLauncher(entries, selected, scroll)
+
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch e := event.(type) {
+			case *sdl.KeyboardEvent:
+				if e.Type != sdl.KEYDOWN {
+					continue
+				}
+				switch e.Keysym.Sym {
+				case sdl.K_UP:
+					selected = nextSelectable(entries, selected, -1)
+				case sdl.K_DOWN:
+					selected = nextSelectable(entries, selected, 1)
+				case sdl.K_PAGEUP:
+					for i := 0; i < launcherRows(); i++ {
+						selected = nextSelectable(entries, selected, -1)
+					}
+				case sdl.K_PAGEDOWN:
+					for i := 0; i < launcherRows(); i++ {
+						selected = nextSelectable(entries, selected, 1)
+					}
+				case sdl.K_RETURN:
+					if romPath, ok := open(); ok {
+						return romPath, true
+					}
+				case sdl.K_BACKSPACE:
+					browse(filepath.Dir(filepath.Clean(romDir)))
+				case sdl.K_ESCAPE:
+					//Back to the game, or quit if there isn't one
+					if cpu == nil {
+						running = false
+					}
+					return "", false
+				}
+			case *sdl.MouseButtonEvent:
+				if e.Type != sdl.MOUSEBUTTONDOWN || e.Button != sdl.BUTTON_LEFT {
+					continue
+				}
+				row := scroll + int((e.Y-launcherMargin)/launcherLineHeight)
+				if e.Y < launcherMargin || row >= len(entries) || entries[row].header {
+					continue
+				}
+				//Click to select, click again to open
+				if row == selected || e.Clicks > 1 {
+					selected = row
+					if romPath, ok := open(); ok {
+						return romPath, true
+					}
+				} else {
+					selected = row
+				}
+			case *sdl.MouseWheelEvent:
+				for i := int32(0); i < e.Y; i++ {
+					selected = nextSelectable(entries, selected, -1)
+				}
+				for i := int32(0); i > e.Y; i-- {
+					selected = nextSelectable(entries, selected, 1)
+				}
+			case *sdl.DropEvent:
+				if e.Type == sdl.DROPFILE {
+					return e.File, true
+				}
+			case *sdl.QuitEvent:
+				running = false
+			}
+		}
+		sdl.Delay(16)
+	}
+
+	return "", false
+}
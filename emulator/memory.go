@@ -0,0 +1,191 @@
+package emulator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+//Memory pane, a hex and ascii view of the 4k of memory that can be edited while paused
+var memoryPane *widgets.Paragraph
+var memoryRows int = 16 //Rows of 16 bytes shown at once
+var memoryTop uint16 = 0x200
+var memoryCursor uint16 = 0x200
+
+//Editing takes two hex digits per byte, goto takes up to three for an address
+var memoryEditing bool = false
+var memoryEditDigit string
+var memoryGoto string
+var memoryGotoActive bool = false
+
+//memoryRecentCycles is how many instructions ago a write still counts as recent
+var memoryRecentCycles uint64 = 600
+
+func initMemoryPane(top int) *widgets.Paragraph {
+	pane := widgets.NewParagraph()
+	pane.Title = "Memory"
+	pane.BorderStyle.Fg = ui.ColorGreen
+	pane.SetRect(1, top, 73, top+memoryRows+2)
+	return pane
+}
+
+func cpuPaused() bool {
+	return executing == -1 || stepMode == 1
+}
+
+func memoryJump(addr uint16) {
+	//Moves the cursor, scrolling so it's on screen
+	memoryCursor = addr & 0xFFF
+	row := memoryCursor &^ 0xF
+	if row < memoryTop {
+		memoryTop = row
+	} else if row >= memoryTop+uint16(memoryRows)*16 {
+		memoryTop = row - uint16(memoryRows-1)*16
+	}
+}
+
+func memoryByteStyle(addr uint16) string {
+	//Colours a byte by what it is, the cursor first then the pc, I, recent writes and the font
+	switch {
+	case addr == memoryCursor && debuggerFocus == focusMemory:
+		return "fg:black,bg:white"
+	case addr == cpu.pc || addr == cpu.pc+1:
+		return "fg:black,bg:green"
+	case addr == cpu.index:
+		return "fg:black,bg:yellow"
+	case watchpoints[addr]:
+		return "fg:white,bg:red"
+	case cpu.lastWrite[addr] > 0 && cpu.cycles-cpu.lastWrite[addr] < memoryRecentCycles:
+		return "fg:red"
+	case int(addr) < len(fontset):
+		return "fg:cyan"
+	}
+	return ""
+}
+
+func updateMemoryPane() {
+	stopEditingIfRunning()
+	lines := make([]string, 0, memoryRows)
+	for row := 0; row < memoryRows; row++ {
+		start := memoryTop + uint16(row*16)
+		if start >= 0x1000 {
+			break
+		}
+
+		hex := make([]string, 0, 16)
+		var ascii strings.Builder
+		for i := uint16(0); i < 16; i++ {
+			addr := start + i
+			value := cpu.memory[addr]
+			text := fmt.Sprintf("%02X", value)
+			if addr == memoryCursor && memoryEditing && memoryEditDigit != "" {
+				text = memoryEditDigit + "_"
+			}
+			if style := memoryByteStyle(addr); style != "" {
+				text = fmt.Sprintf("[%s](%s)", text, style)
+			}
+			hex = append(hex, text)
+
+			//Brackets and parentheses would be taken as termui styling
+			char := rune(value)
+			if char < 0x20 || char > 0x7E || strings.ContainsRune("[]()", char) {
+				char = '.'
+			}
+			ascii.WriteRune(char)
+		}
+		lines = append(lines, fmt.Sprintf("[%03X](fg:green) %s  %s", start, strings.Join(hex, " "), ascii.String()))
+	}
+	memoryPane.Text = strings.Join(lines, "\n")
+
+	switch {
+	case memoryGotoActive:
+		memoryPane.Title = fmt.Sprintf("Memory - goto %s_", memoryGoto)
+	case memoryEditing:
+		memoryPane.Title = fmt.Sprintf("Memory - editing %03X", memoryCursor)
+	default:
+		memoryPane.Title = fmt.Sprintf("Memory - %03X", memoryCursor)
+	}
+}
+
+func handleMemoryKey(id string) bool {
+	//Arrows and page keys move, g goes to an address, i and p jump to I and the pc, w toggles a watchpoint and enter
+	//edits. Returns whether it was used
+	if memoryGotoActive {
+		switch {
+		case id == "<Enter>":
+			if addr, err := strconv.ParseUint(memoryGoto, 16, 16); err == nil {
+				memoryJump(uint16(addr))
+			}
+			memoryGotoActive = false
+		case id == "<Escape>":
+			memoryGotoActive = false
+		case id == "<Backspace>" && len(memoryGoto) > 0:
+			memoryGoto = memoryGoto[:len(memoryGoto)-1]
+		case isHexDigit(id) && len(memoryGoto) < 3:
+			memoryGoto += strings.ToUpper(id)
+		}
+		return true
+	}
+
+	stopEditingIfRunning()
+	if memoryEditing && isHexDigit(id) {
+		memoryEditDigit += strings.ToUpper(id)
+		if len(memoryEditDigit) == 2 {
+			value, _ := strconv.ParseUint(memoryEditDigit, 16, 8)
+			cpu.memory[memoryCursor] = uint8(value)
+			memoryEditDigit = ""
+
+			//Stepping back past an edit would run the rom's past against memory it never had, so history starts again here
+			clearHistory()
+			historyMessage = fmt.Sprintf("memory edited at %03X, history cleared", memoryCursor)
+			memoryJump(memoryCursor + 1)
+		}
+		return true
+	}
+
+	switch id {
+	case "<Left>":
+		memoryJump(memoryCursor - 1)
+	case "<Right>":
+		memoryJump(memoryCursor + 1)
+	case "<Up>":
+		memoryJump(memoryCursor - 16)
+	case "<Down>":
+		memoryJump(memoryCursor + 16)
+	case "<PageUp>":
+		memoryJump(memoryCursor - uint16(memoryRows)*16)
+	case "<PageDown>":
+		memoryJump(memoryCursor + uint16(memoryRows)*16)
+	case "i":
+		memoryJump(cpu.index)
+	case "p":
+		memoryJump(cpu.pc)
+	case "g":
+		memoryGotoActive, memoryGoto = true, ""
+	case "w":
+		toggleWatchpoint(memoryCursor)
+	case "<Enter>":
+		//Only while paused, so the rom isn't changing memory underneath the edit
+		memoryEditing = !memoryEditing && cpuPaused()
+		memoryEditDigit = ""
+	case "<Escape>":
+		memoryEditing, memoryEditDigit = false, ""
+	default:
+		return false
+	}
+	return true
+}
+
+func stopEditingIfRunning() {
+	//Editing ends once the rom runs again, so a half typed byte isn't written into memory the rom is using
+	if memoryEditing && !cpuPaused() {
+		memoryEditing, memoryEditDigit = false, ""
+	}
+}
+
+func isHexDigit(id string) bool {
+	return len(id) == 1 && strings.ContainsAny(strings.ToLower(id), "0123456789abcdef")
+}
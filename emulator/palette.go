@@ -0,0 +1,156 @@
+package emulator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//palette is a set of colours to draw the display with
+type palette struct {
+	name   string
+	colors []uint32 //Indexed by pixel value, 0 is the background and 1 the foreground. Multi-plane modes use up to 16
+	border uint32
+}
+
+//paletteConfig is a custom palette from the config, colours are hex strings like "#7289DA"
+type paletteConfig struct {
+	Colors []string `toml:"colors"`
+	Border string   `toml:"border"`
+}
+
+//palettes holds the built in palettes followed by any from the config
+var palettes = []palette{
+	{"default", []uint32{0x2C2F33, 0x7289DA}, 0x7289DA},
+	{"classic", []uint32{0x000000, 0xFFFFFF}, 0x404040},
+	{"amber", []uint32{0x1A0F00, 0xFFB000, 0xB37B00, 0xFFD080}, 0x3D2600},
+	{"green phosphor", []uint32{0x051405, 0x33FF66, 0x1F9940, 0xA0FFB8}, 0x0F3318},
+	{"game boy", []uint32{0x9BBC0F, 0x0F380F, 0x8BAC0F, 0x306230}, 0x306230},
+	{"high contrast", []uint32{0x000000, 0xFFFF00, 0x00FFFF, 0xFFFFFF}, 0xFFFFFF},
+	//Okabe-Ito colours, which stay distinguishable with the common forms of colour blindness
+	{"colour-blind safe", []uint32{0x000000, 0xE69F00, 0x56B4E9, 0xF0E442}, 0x009E73},
+	{"cga", []uint32{
+		0x000000, 0xFFFFFF, 0x0000AA, 0x00AA00, 0x00AAAA, 0xAA0000, 0xAA00AA, 0xAA5500,
+		0xAAAAAA, 0x555555, 0x5555FF, 0x55FF55, 0x55FFFF, 0xFF5555, 0xFF55FF, 0xFFFF55,
+	}, 0x555555},
+}
+
+var paletteIndex int = 0
+
+func activePalette() palette {
+	return palettes[paletteIndex]
+}
+
+func (p palette) background() uint32 {
+	return p.colors[0]
+}
+
+func (p palette) foreground() uint32 {
+	return p.colors[1]
+}
+
+func (p palette) pixel(value uint8) uint32 {
+	//Colour for a pixel value, palettes with fewer colours than planes draw every set pixel in the foreground colour
+	if int(value) < len(p.colors) {
+		return p.colors[value]
+	}
+	return p.foreground()
+}
+
+func parseColor(hex string) (uint32, error) {
+	value, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(hex, "#"), "0x"), 16, 32)
+	if err != nil || value > 0xFFFFFF {
+		return 0, fmt.Errorf("invalid colour %q", hex)
+	}
+	return uint32(value), nil
+}
+
+func parsePalette(name string, colors []string, border string) (palette, error) {
+	//Builds a palette from hex strings, the border defaults to the foreground colour
+	p := palette{name: name}
+	if len(colors) < 2 || len(colors) > 16 {
+		return p, fmt.Errorf("palette %q needs between 2 and 16 colours", name)
+	}
+	for _, hex := range colors {
+		color, err := parseColor(hex)
+		if err != nil {
+			return p, err
+		}
+		p.colors = append(p.colors, color)
+	}
+
+	p.border = p.foreground()
+	if border != "" {
+		color, err := parseColor(border)
+		if err != nil {
+			return p, err
+		}
+		p.border = color
+	}
+	return p, nil
+}
+
+func loadPalettes() {
+	//Adds the palettes from the config, a custom palette with the name of a built in one replaces it
+	names := make([]string, 0)
+	for name := range settings.Palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		conf := settings.Palettes[name]
+		p, err := parsePalette(name, conf.Colors, conf.Border)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if i := findPalette(name); i != -1 {
+			palettes[i] = p
+		} else {
+			palettes = append(palettes, p)
+		}
+	}
+}
+
+func findPalette(name string) int {
+	for i, p := range palettes {
+		if strings.EqualFold(p.name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func selectPalette(conf romConfig, info romInfo) {
+	//Picks the rom's palette from its config, then the database's colours for it and finally the global config
+	name := settings.Palette
+	if conf.Palette != "" {
+		name = conf.Palette
+	} else if pixels := info.entry.Colors.Pixels; len(pixels) > 0 {
+		if p, err := parsePalette(info.program.Title, pixels, ""); err == nil {
+			if i := findPalette(p.name); i != -1 {
+				palettes[i] = p
+			} else {
+				palettes = append(palettes, p)
+			}
+			name = p.name
+		}
+	}
+
+	//Without one the default is used, not whatever the last rom had
+	paletteIndex = 0
+	if name == "" {
+		return
+	}
+	if i := findPalette(name); i != -1 {
+		paletteIndex = i
+	} else {
+		fmt.Printf("unknown palette %q\n", name)
+	}
+}
+
+func cyclePalette() {
+	paletteIndex = (paletteIndex + 1) % len(palettes)
+}
@@ -0,0 +1,135 @@
+package emulator
+
+import (
+	"fmt"
+)
+
+//Presentation modes, chip8 games erase and redraw sprites with XOR so showing every draw makes them flicker
+const (
+	presentImmediate = "immediate" //Show every DRW and CLS as it happens, like the emulator always has
+	presentFrame     = "frame"     //Show the display once per 60hz frame
+	presentBlend     = "blend"     //Average the last few frames together
+	presentPhosphor  = "phosphor"  //Pixels light up straight away and fade out over a few frames
+)
+
+var presentModes = []string{presentImmediate, presentFrame, presentBlend, presentPhosphor}
+var presentMode string = presentImmediate
+
+//How many frames are blended, and how many a pixel takes to fade out in phosphor mode
+var blendFrames int = 3
+var phosphorFrames int = 8
+
+//frameHistory holds the most recent frames, newest last. Only the newest is kept outside of blend mode
+var frameHistory [][32][64]uint8
+
+//phosphor is the brightness of each pixel between 0 and 1, along with the last value it was lit with
+var phosphor [32][64]float64
+var phosphorValue [32][64]uint8
+
+func parsePresentMode(mode string) (string, error) {
+	for _, m := range presentModes {
+		if m == mode {
+			return m, nil
+		}
+	}
+	return presentMode, fmt.Errorf("unknown presentation mode %q", mode)
+}
+
+func cyclePresentMode() {
+	for i, m := range presentModes {
+		if m == presentMode {
+			presentMode = presentModes[(i+1)%len(presentModes)]
+			break
+		}
+	}
+	resetPresentation()
+}
+
+func resetPresentation() {
+	//Forgets old frames, used when the rom or mode changes so nothing from before lingers
+	frameHistory = frameHistory[:0]
+	phosphor = [32][64]float64{}
+	captureFrame(&cpu.display)
+}
+
+func captureFrame(videoArr *[32][64]uint8) {
+	//Adds the display as it is now to the history and fades the phosphor by a frame
+	keep := 1
+	if presentMode == presentBlend && blendFrames > 1 {
+		keep = blendFrames
+	}
+	frameHistory = append(frameHistory, *videoArr)
+	if len(frameHistory) > keep {
+		frameHistory = frameHistory[len(frameHistory)-keep:]
+	}
+
+	decay := 1 / float64(phosphorFrames)
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			if value := videoArr[y][x]; value != 0 {
+				phosphor[y][x] = 1
+				phosphorValue[y][x] = value
+			} else if phosphor[y][x] > decay {
+				phosphor[y][x] -= decay
+			} else {
+				phosphor[y][x] = 0
+			}
+		}
+	}
+}
+
+func presentDisplay() {
+	//Called once every 60hz frame, immediate mode has already shown everything as it was drawn
+	if presentMode == presentImmediate {
+		return
+	}
+	captureFrame(&cpu.display)
+	redraw()
+}
+
+func composeFrame(videoArr *[32][64]uint8, colors palette) [32][64]uint32 {
+	//Works out the colour of every pixel for the current presentation mode
+	var frame [32][64]uint32
+
+	//Stepping shows the display as the rom left it, blending it with frames from before the step would hide the change
+	if presentMode == presentImmediate || len(frameHistory) == 0 || stepMode == 1 {
+		for y := 0; y < 32; y++ {
+			for x := 0; x < 64; x++ {
+				frame[y][x] = colors.pixel(videoArr[y][x])
+			}
+		}
+		return frame
+	}
+
+	newest := &frameHistory[len(frameHistory)-1]
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			switch presentMode {
+			case presentBlend:
+				var r, g, b int
+				for i := range frameHistory {
+					c := colors.pixel(frameHistory[i][y][x])
+					r += int(c>>16) & 0xFF
+					g += int(c>>8) & 0xFF
+					b += int(c) & 0xFF
+				}
+				n := len(frameHistory)
+				frame[y][x] = uint32(r/n)<<16 | uint32(g/n)<<8 | uint32(b/n)
+			case presentPhosphor:
+				frame[y][x] = mixColor(colors.background(), colors.pixel(phosphorValue[y][x]), phosphor[y][x])
+			default:
+				frame[y][x] = colors.pixel(newest[y][x])
+			}
+		}
+	}
+	return frame
+}
+
+func mixColor(from uint32, to uint32, amount float64) uint32 {
+	//Blends between two colours, amount 0 being all from and 1 all to
+	mix := func(shift uint) uint32 {
+		a, b := float64((from>>shift)&0xFF), float64((to>>shift)&0xFF)
+		return uint32(a+(b-a)*amount+0.5) << shift
+	}
+	return mix(16) | mix(8) | mix(0)
+}
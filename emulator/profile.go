@@ -0,0 +1,361 @@
+package emulator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+//profiler counts the instructions run at each address and the chain of subroutine calls they were run under, found by
+//following CALL and RET
+type profiler struct {
+	path    string
+	frames  []profileFrame
+	stack   string //frames packed into a string so it can key samples, rebuilt on CALL and RET
+	samples map[profileKey]uint64
+	total   uint64
+	start   time.Time
+}
+
+//profileFrame is a subroutine on the call stack, entered at entry by the CALL at callSite
+type profileFrame struct {
+	entry    uint16
+	callSite uint16
+}
+
+type profileKey struct {
+	stack string
+	pc    uint16
+}
+
+//Entries that aren't addresses, for code outside any subroutine and for calls made before the profiler saw them
+const (
+	profileMain    uint16 = 0xFFFF
+	profileUnknown uint16 = 0xFFFE
+)
+
+//profiling is the profiler asked for with -profile, profileTop is how many rows of hot spots are printed on exit
+var profiling *profiler
+var profileTop int = 20
+
+func newProfiler(path string) *profiler {
+	return &profiler{path: path, samples: make(map[profileKey]uint64), start: time.Now()}
+}
+
+func (p *profiler) count(c *CPU) {
+	//Called with the pc on each instruction before it runs
+	if len(p.frames) != int(c.stkptr) {
+		p.sync(c)
+	}
+	p.samples[profileKey{p.stack, c.pc}]++
+	p.total++
+
+	identifier := c.opcode >> 12
+	if identifier == 0x2 && c.stkptr < 16 {
+		p.frames = append(p.frames, profileFrame{c.opcode & 0xFFF, c.pc})
+		p.packStack()
+	} else if identifier == 0x0 && c.opcode&0xFF == 0xEE && len(p.frames) > 0 {
+		p.frames = p.frames[:len(p.frames)-1]
+		p.packStack()
+	}
+}
+
+func (p *profiler) sync(c *CPU) {
+	//Matches the frames to the cpu's stack after a reset or anything else the profiler didn't see
+	if len(p.frames) > int(c.stkptr) {
+		p.frames = p.frames[:c.stkptr]
+	}
+	for i := len(p.frames); i < int(c.stkptr); i++ {
+		p.frames = append(p.frames, profileFrame{profileUnknown, c.stack[i] - 2})
+	}
+	p.packStack()
+}
+
+func (p *profiler) packStack() {
+	packed := make([]byte, 0, len(p.frames)*4)
+	for _, frame := range p.frames {
+		packed = append(packed, byte(frame.entry>>8), byte(frame.entry), byte(frame.callSite>>8), byte(frame.callSite))
+	}
+	p.stack = string(packed)
+}
+
+func unpackStack(stack string) []profileFrame {
+	frames := make([]profileFrame, 0, len(stack)/4)
+	for i := 0; i+3 < len(stack); i += 4 {
+		frames = append(frames, profileFrame{
+			uint16(stack[i])<<8 | uint16(stack[i+1]),
+			uint16(stack[i+2])<<8 | uint16(stack[i+3]),
+		})
+	}
+	return frames
+}
+
+func subroutineName(entry uint16) string {
+	switch entry {
+	case profileMain:
+		return "main"
+	case profileUnknown:
+		return "unknown"
+	}
+	if label, ok := symbols[entry]; ok {
+		return label
+	}
+	return fmt.Sprintf("sub_%03X", entry)
+}
+
+//profileLocation is an address within a subroutine, pprof's locations are one function each
+type profileLocation struct {
+	addr  uint16
+	entry uint16
+}
+
+func (p *profiler) locations(key profileKey) []profileLocation {
+	//Walks the stack for a sample from the instruction itself out to main, the way pprof wants it
+	frames := unpackStack(key.stack)
+	entry := profileMain
+	if len(frames) > 0 {
+		entry = frames[len(frames)-1].entry
+	}
+	locations := []profileLocation{{key.pc, entry}}
+	for i := len(frames) - 1; i >= 0; i-- {
+		caller := profileMain
+		if i > 0 {
+			caller = frames[i-1].entry
+		}
+		locations = append(locations, profileLocation{frames[i].callSite, caller})
+	}
+	return locations
+}
+
+//protoBuffer writes the few protobuf wire types the pprof format needs
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+func (b *protoBuffer) varint(value uint64) {
+	for value >= 0x80 {
+		b.WriteByte(byte(value) | 0x80)
+		value >>= 7
+	}
+	b.WriteByte(byte(value))
+}
+
+func (b *protoBuffer) uintField(field int, value uint64) {
+	b.varint(uint64(field) << 3)
+	b.varint(value)
+}
+
+func (b *protoBuffer) bytesField(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.Write(data)
+}
+
+func (b *protoBuffer) packedField(field int, values []uint64) {
+	var packed protoBuffer
+	for _, value := range values {
+		packed.varint(value)
+	}
+	b.bytesField(field, packed.Bytes())
+}
+
+func (p *profiler) encode(romPath string) []byte {
+	//Builds a profile.proto message, with each instruction's address as its line number so pprof can list by address
+	stringTable := []string{""}
+	stringIndex := map[string]uint64{"": 0}
+	str := func(s string) uint64 {
+		if i, ok := stringIndex[s]; ok {
+			return i
+		}
+		stringIndex[s] = uint64(len(stringTable))
+		stringTable = append(stringTable, s)
+		return stringIndex[s]
+	}
+	valueType := func(kind string, unit string) []byte {
+		var b protoBuffer
+		b.uintField(1, str(kind))
+		b.uintField(2, str(unit))
+		return b.Bytes()
+	}
+
+	var profile protoBuffer
+	profile.bytesField(1, valueType("instructions", "count"))
+
+	functionIDs := make(map[uint16]uint64)
+	locationIDs := make(map[profileLocation]uint64)
+	var functions, locations protoBuffer
+
+	for key, count := range p.samples {
+		ids := make([]uint64, 0)
+		for _, location := range p.locations(key) {
+			if _, ok := functionIDs[location.entry]; !ok {
+				id := uint64(len(functionIDs) + 1)
+				functionIDs[location.entry] = id
+				var function protoBuffer
+				function.uintField(1, id)
+				function.uintField(2, str(subroutineName(location.entry)))
+				function.uintField(3, str(subroutineName(location.entry)))
+				function.uintField(4, str(romPath))
+				if location.entry < 0x1000 {
+					function.uintField(5, uint64(location.entry))
+				}
+				functions.bytesField(5, function.Bytes())
+			}
+			if _, ok := locationIDs[location]; !ok {
+				id := uint64(len(locationIDs) + 1)
+				locationIDs[location] = id
+				var line, loc protoBuffer
+				line.uintField(1, functionIDs[location.entry])
+				line.uintField(2, uint64(location.addr))
+				loc.uintField(1, id)
+				loc.uintField(2, 1)
+				loc.uintField(3, uint64(location.addr))
+				loc.bytesField(4, line.Bytes())
+				locations.bytesField(4, loc.Bytes())
+			}
+			ids = append(ids, locationIDs[location])
+		}
+
+		var sample protoBuffer
+		sample.packedField(1, ids)
+		sample.packedField(2, []uint64{count})
+		profile.bytesField(2, sample.Bytes())
+	}
+
+	//A single mapping covers the 4k of memory
+	var mapping protoBuffer
+	mapping.uintField(1, 1)
+	mapping.uintField(3, 0x1000)
+	mapping.uintField(5, str(filepath.Base(romPath)))
+	mapping.uintField(7, 1)
+	mapping.uintField(8, 1)
+	mapping.uintField(9, 1)
+	profile.bytesField(3, mapping.Bytes())
+	profile.Write(locations.Bytes())
+	profile.Write(functions.Bytes())
+
+	periodType := valueType("instructions", "count")
+	for _, s := range stringTable {
+		profile.bytesField(6, []byte(s))
+	}
+	profile.uintField(9, uint64(p.start.UnixNano()))
+	profile.uintField(10, uint64(time.Since(p.start).Nanoseconds()))
+	profile.bytesField(11, periodType)
+	profile.uintField(12, 1)
+	return profile.Bytes()
+}
+
+func (p *profiler) write(romPath string) error {
+	//pprof reads profiles gzipped
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(p.encode(romPath))
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p.path, compressed.Bytes(), 0644)
+}
+
+//profileRow is a line of the hot spot tables
+type profileRow struct {
+	name  string
+	flat  uint64
+	cum   uint64
+	entry uint16
+}
+
+func (p *profiler) printTop(n int) {
+	//Prints the busiest addresses and subroutines
+	addresses := make(map[uint16]*profileRow)
+	subroutines := make(map[uint16]*profileRow)
+	for key, count := range p.samples {
+		locations := p.locations(key)
+
+		row, ok := addresses[key.pc]
+		if !ok {
+			row = &profileRow{entry: locations[0].entry}
+			addresses[key.pc] = row
+		}
+		row.flat += count
+
+		//Recursion would count a subroutine's time more than once towards its cumulative total
+		seen := make(map[uint16]bool)
+		for i, location := range locations {
+			sub, ok := subroutines[location.entry]
+			if !ok {
+				sub = &profileRow{name: subroutineName(location.entry)}
+				subroutines[location.entry] = sub
+			}
+			if i == 0 {
+				sub.flat += count
+			}
+			if !seen[location.entry] {
+				sub.cum += count
+				seen[location.entry] = true
+			}
+		}
+	}
+
+	percent := func(count uint64) float64 {
+		return float64(count) * 100 / float64(p.total)
+	}
+
+	fmt.Printf("Profile: %d instructions in %s, written to %s\n\n", p.total, time.Since(p.start).Round(time.Millisecond), p.path)
+
+	addrs := make([]uint16, 0, len(addresses))
+	for addr := range addresses {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if addresses[addrs[i]].flat != addresses[addrs[j]].flat {
+			return addresses[addrs[i]].flat > addresses[addrs[j]].flat
+		}
+		return addrs[i] < addrs[j]
+	})
+	fmt.Printf("%10s %7s  %-7s %-16s %s\n", "count", "%", "address", "instruction", "subroutine")
+	for i, addr := range addrs {
+		if i == n {
+			break
+		}
+		row := addresses[addr]
+		fmt.Printf("%10d %6.2f%%  %03X     %-16s %s\n", row.flat, percent(row.flat), addr,
+			disassemble(cpu.opcodeAt(addr)), subroutineName(row.entry))
+	}
+	fmt.Println()
+
+	subs := make([]*profileRow, 0, len(subroutines))
+	for _, row := range subroutines {
+		subs = append(subs, row)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		if subs[i].cum != subs[j].cum {
+			return subs[i].cum > subs[j].cum
+		}
+		return subs[i].name < subs[j].name
+	})
+	fmt.Printf("%10s %7s %10s %7s  %s\n", "flat", "flat%", "cum", "cum%", "subroutine")
+	for i, row := range subs {
+		if i == n {
+			break
+		}
+		fmt.Printf("%10d %6.2f%% %10d %6.2f%%  %s\n", row.flat, percent(row.flat), row.cum, percent(row.cum), row.name)
+	}
+}
+
+func saveProfile() {
+	//Deferred by RunEmulator so the profile is written and the table printed after the terminal is given back
+	if profiling == nil || cpu == nil || profiling.total == 0 {
+		return
+	}
+	if err := profiling.write(cpu.romPath); err != nil {
+		fmt.Printf("couldn't write profile: %s\n", err)
+	}
+	if profileTop > 0 {
+		profiling.printTop(profileTop)
+	}
+	profiling = nil
+}
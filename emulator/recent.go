@@ -0,0 +1,55 @@
+package emulator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//recentRoms are the most recently played roms, newest first, kept in the user's config directory
+var recentRoms []string
+var maxRecentRoms int = 8
+
+func recentRomsPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gochip8", "recent")
+}
+
+func loadRecentRoms() {
+	data, err := ioutil.ReadFile(recentRomsPath())
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			recentRoms = append(recentRoms, line)
+		}
+	}
+}
+
+func addRecentRom(romPath string) {
+	//Moves the rom to the front of the list and saves it, failing to save isn't worth stopping over
+	if abs, err := filepath.Abs(romPath); err == nil {
+		romPath = abs
+	}
+
+	roms := []string{romPath}
+	for _, recent := range recentRoms {
+		if recent != romPath && len(roms) < maxRecentRoms {
+			roms = append(roms, recent)
+		}
+	}
+	recentRoms = roms
+
+	filePath := recentRomsPath()
+	if filePath == "" {
+		return
+	}
+	if os.MkdirAll(filepath.Dir(filePath), 0755) == nil {
+		ioutil.WriteFile(filePath, []byte(strings.Join(recentRoms, "\n")+"\n"), 0644)
+	}
+}
@@ -0,0 +1,219 @@
+package emulator
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	gifpalette "image/color/palette"
+	"image/draw"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//Recordings are written as an animated gif, a y4m video or raw rgb24 frames, picked by the file extension
+var recordFormat string = "gif"
+
+//recorder captures every presented frame, along with the buzzer, until it's stopped
+type recorder struct {
+	path   string
+	format string
+	frames int //Frames recorded so far
+
+	//gif
+	anim       *gif.GIF
+	last       *image.Paletted
+	lastFrame  int //Frame the last gif image started on, repeated frames make it last longer instead of being added
+	lastPixels []uint8
+
+	//y4m and raw
+	file   *os.File
+	stream *bufio.Writer
+
+	audio wavCapture
+}
+
+var recording *recorder
+
+func startRecording(path string) (*recorder, error) {
+	r := &recorder{path: path, format: strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")}
+	r.audio.path = strings.TrimSuffix(path, filepath.Ext(path)) + ".wav"
+	switch r.format {
+	case "gif":
+		r.anim = &gif.GIF{}
+	case "y4m", "rgb", "raw":
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		r.file, r.stream = file, bufio.NewWriter(file)
+	default:
+		return nil, fmt.Errorf("can't record to %q, use a .gif, .y4m or .rgb file", path)
+	}
+	return r, nil
+}
+
+func (r *recorder) addFrame(videoArr *[32][64]uint8, buzzing bool) error {
+	img := screenshotImage(videoArr, screenshotScale)
+	r.audio.addFrame(buzzing)
+
+	var err error
+	switch r.format {
+	case "gif":
+		r.addGifFrame(img)
+	case "y4m":
+		err = r.addY4mFrame(img)
+	default:
+		for i := 0; i < len(img.Pix) && err == nil; i += 4 {
+			_, err = r.stream.Write(img.Pix[i : i+3])
+		}
+	}
+	r.frames++
+	return err
+}
+
+func (r *recorder) addGifFrame(img *image.RGBA) {
+	//Frames that look the same as the last one are dropped and the last one is shown for longer
+	if r.last != nil && string(img.Pix) == string(r.lastPixels) {
+		return
+	}
+	//Use the colours actually on screen when there are few enough of them, which is always the case without filters
+	colors := make(color.Palette, 0)
+	seen := make(map[color.RGBA]bool)
+	for i := 0; i < len(img.Pix); i += 4 {
+		c := color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], 0xFF}
+		if !seen[c] {
+			seen[c] = true
+			colors = append(colors, c)
+		}
+	}
+
+	var frame *image.Paletted
+	if len(colors) <= 256 {
+		frame = image.NewPaletted(img.Bounds(), colors)
+		draw.Draw(frame, frame.Rect, img, image.Point{}, draw.Src)
+	} else {
+		frame = image.NewPaletted(img.Bounds(), gifpalette.Plan9)
+		draw.FloydSteinberg.Draw(frame, frame.Rect, img, image.Point{})
+	}
+
+	if r.last != nil && gifTime(r.frames) == gifTime(r.lastFrame) {
+		//Too soon after the last image to be shown, so this one takes its place
+		r.anim.Image[len(r.anim.Image)-1] = frame
+	} else {
+		r.finishGifFrame()
+		r.anim.Image = append(r.anim.Image, frame)
+		r.anim.Delay = append(r.anim.Delay, 0)
+		r.lastFrame = r.frames
+	}
+	r.last, r.lastPixels = frame, append([]uint8(nil), img.Pix...)
+}
+
+func gifTime(frame int) int {
+	//When a frame is shown in the gif, in hundredths of a second. Viewers slow down anything shown for less than 2, so
+	//images are lined up to 50fps and working them out from the frame count stops them drifting from 60hz
+	return (frame*100/60 + 1) / 2 * 2
+}
+
+func (r *recorder) finishGifFrame() {
+	if r.last == nil {
+		return
+	}
+	delay := gifTime(r.frames) - gifTime(r.lastFrame)
+	if delay < 2 {
+		delay = 2
+	}
+	r.anim.Delay[len(r.anim.Delay)-1] = delay
+}
+
+func (r *recorder) addY4mFrame(img *image.RGBA) error {
+	//Y4M frames are full range 4:4:4 YCbCr, one plane after another
+	if r.frames == 0 {
+		size := img.Bounds().Size()
+		fmt.Fprintf(r.stream, "YUV4MPEG2 W%d H%d F60:1 Ip A1:1 C444 XCOLORRANGE=FULL\n", size.X, size.Y)
+	}
+	planes := [3][]uint8{}
+	for i := 0; i < len(img.Pix); i += 4 {
+		y, cb, cr := color.RGBToYCbCr(img.Pix[i], img.Pix[i+1], img.Pix[i+2])
+		planes[0] = append(planes[0], y)
+		planes[1] = append(planes[1], cb)
+		planes[2] = append(planes[2], cr)
+	}
+	r.stream.WriteString("FRAME\n")
+	for _, plane := range planes {
+		if _, err := r.stream.Write(plane); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *recorder) stop() error {
+	//Writes out the recording and the buzzer next to it as a wav
+	var err error
+	if r.format == "gif" {
+		r.finishGifFrame()
+		if len(r.anim.Image) == 0 {
+			return fmt.Errorf("nothing was recorded")
+		}
+		var file *os.File
+		if file, err = os.Create(r.path); err != nil {
+			return err
+		}
+		err = gif.EncodeAll(file, r.anim)
+		file.Close()
+	} else {
+		err = r.stream.Flush()
+		r.file.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	return r.audio.save()
+}
+
+func recordFrame() error {
+	//Called after every presented frame
+	if recording == nil {
+		return nil
+	}
+	return recording.addFrame(&cpu.display, cpu.soundTimer > 0)
+}
+
+func stopRecording() {
+	//Saves a recording still going when the emulator is closed
+	if recording == nil {
+		return
+	}
+	if err := recording.stop(); err != nil {
+		fmt.Printf("recording failed: %s\n", err)
+	}
+	recording = nil
+}
+
+func toggleRecording() {
+	//Starts recording to a file named after the time, or stops and saves the recording in progress
+	if recording != nil {
+		err := recording.stop()
+		if err != nil {
+			appendInstruction(&instructionSlice, fmt.Sprintf("[recording failed: %s](fg:red)\n", err))
+		} else {
+			appendInstruction(&instructionSlice, fmt.Sprintf("[saved %s](fg:red)\n", recording.path))
+		}
+		recording = nil
+		return
+	}
+
+	fileName := fmt.Sprintf("recording-%s.%s", time.Now().Format("20060102-150405"), recordFormat)
+	r, err := startRecording(fileName)
+	if err != nil {
+		appendInstruction(&instructionSlice, fmt.Sprintf("[recording failed: %s](fg:red)\n", err))
+		return
+	}
+	recording = r
+	appendInstruction(&instructionSlice, fmt.Sprintf("[recording to %s](fg:red)\n", fileName))
+}
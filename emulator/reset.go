@@ -0,0 +1,53 @@
+package emulator
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+func resetCPU() {
+	//Soft reset, restarts the rom from the copy already in memory
+	cpu = newCPU(cpu.romPath, cpu.romData)
+	afterReset("reset")
+}
+
+func reloadCPU() {
+	//Hard reset, reads the rom file again in case it changed. The old rom keeps running if it can't be read
+	fileData, err := ioutil.ReadFile(cpu.romPath)
+	if err != nil {
+		appendInstruction(&instructionSlice, fmt.Sprintf("[reload failed: %s](fg:red)\n", err))
+		return
+	}
+
+	cpu = newCPU(cpu.romPath, fileData)
+	afterReset("reloaded from disk")
+}
+
+func afterReset(message string) {
+	//Everything outside the cpu, like breakpoints, speed and debug modes, is kept as is
+	appendInstruction(&instructionSlice, fmt.Sprintf("[--- %s ---](fg:red)\n", message))
+	clearHistory()
+	refreshDebugger()
+	setWindowTitle()
+	resetPresentation()
+	redraw()
+}
+
+func setWindowTitle() {
+	//Shows the rom's title from the database if it's known, on the display's border in the terminal
+	title := "GoChip-8"
+	if cpu.rom.known {
+		title = "GoChip-8 - " + cpu.rom.program.Title
+	}
+	if loadError != "" {
+		title += " - " + loadError
+	}
+	if breakMessage != "" {
+		title += " - stopped on a " + breakMessage
+	}
+	if terminalMode {
+		terminalScreen.Title = title
+	} else {
+		window.SetTitle(title)
+	}
+}
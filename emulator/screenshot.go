@@ -0,0 +1,98 @@
+package emulator
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"strconv"
+	"time"
+)
+
+//screenshotScale is how many times bigger than 64x32 screenshots are, above 1 the active filter is applied too
+var screenshotScale int = 1
+
+//A screenshot can be scheduled for a frame with --screenshot-at-frame, frames are counted from when the rom starts
+var screenshotFrame int = 0
+var screenshotPath string
+var frameCount int = 0
+
+func rgb(c uint32) color.RGBA {
+	return color.RGBA{uint8(c >> 16), uint8(c >> 8), uint8(c), 0xFF}
+}
+
+func screenshotImage(videoArr *[32][64]uint8, scale int) *image.RGBA {
+	//The display as it's presented in the active palette, scaled up with nearest neighbour after the filter
+	frame := composeFrame(videoArr, activePalette())
+	b := frameBuffer(&frame)
+	if scale < 1 {
+		scale = 1
+	}
+	if scale > 1 {
+		b = activeFilter().apply(b)
+	}
+
+	width, height := 64*scale, 32*scale
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, rgb(b.at(x*b.width/width, y*b.height/height)))
+		}
+	}
+	return img
+}
+
+func writeScreenshot(fileName string, videoArr *[32][64]uint8) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return png.Encode(file, screenshotImage(videoArr, screenshotScale))
+}
+
+func saveScreenshot(videoArr *[32][64]uint8) {
+	//Writes the display to a png in the current directory, named after the time it was taken
+	fileName := fmt.Sprintf("screenshot-%s.png", time.Now().Format("20060102-150405"))
+	if err := writeScreenshot(fileName, videoArr); err != nil {
+		appendInstruction(&instructionSlice, fmt.Sprintf("[screenshot failed: %s](fg:red)\n", err))
+		return
+	}
+	appendInstruction(&instructionSlice, fmt.Sprintf("[saved %s](fg:red)\n", fileName))
+}
+
+func checkScheduledScreenshot() error {
+	//Takes the screenshot asked for with --screenshot-at-frame once that frame has been presented
+	if screenshotFrame == 0 || frameCount != screenshotFrame {
+		return nil
+	}
+	return writeScreenshot(screenshotPath, &cpu.display)
+}
+
+func takeScreenshotArgs(args []string) ([]string, error) {
+	//--screenshot-at-frame takes two values, a frame and a file, which the flag package can't do so it's pulled out by hand
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		if args[i] != "-screenshot-at-frame" && args[i] != "--screenshot-at-frame" {
+			rest = append(rest, args[i])
+			continue
+		}
+
+		if i+2 >= len(args) {
+			return nil, fmt.Errorf("usage: --screenshot-at-frame N out.png")
+		}
+		frame, err := strconv.Atoi(args[i+1])
+		if err != nil || frame < 1 {
+			return nil, fmt.Errorf("screenshot frame must be a number above 0, not %q", args[i+1])
+		}
+		screenshotFrame, screenshotPath = frame, args[i+2]
+		i += 2
+	}
+	return rest, nil
+}
@@ -0,0 +1,262 @@
+package emulator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+//Sprite pane, draws memory as 8 pixel wide bitmaps so sprites can be checked without decoding the hex
+var spritePane *widgets.Paragraph
+
+//What the sprite pane shows, m cycles through them
+const (
+	spriteNext    = "next DRW" //The sprite the next DRW after the pc draws, from I as it is now
+	spriteIndex   = "I"        //spriteLength bytes at I
+	spriteAddress = "address"  //spriteLength bytes at spriteAddr
+	spriteBrowse  = "browse"   //Memory from spriteAddr as strips of sprites, two bytes to a line
+)
+
+var spriteModes = []string{spriteNext, spriteIndex, spriteAddress, spriteBrowse}
+var spriteMode string = spriteNext
+var spriteAddr uint16 = 0x200
+var spriteLength int = 5 //Bytes shown at I or an address, 5 fits a font glyph
+
+//spriteLookahead is how many instructions past the pc are searched for the next DRW
+var spriteLookahead int = 32
+
+//Rows inside the pane and strips across it when browsing
+var spriteRows int = 16
+var spriteStrips int = 3
+
+var spriteGoto string
+var spriteGotoActive bool = false
+
+func initSpritePane(top int) *widgets.Paragraph {
+	pane := widgets.NewParagraph()
+	pane.Title = "Sprites"
+	pane.BorderStyle.Fg = ui.ColorCyan
+	pane.SetRect(74, top, 119, top+spriteRows+2)
+	return pane
+}
+
+func nextDraw() (uint16, uint16, bool) {
+	//Finds the next Dxyn from the pc on, returning its address and opcode. Jumps aren't followed so it's a guess until
+	//the pc reaches it
+	addr := cpu.pc
+	for i := 0; i < spriteLookahead && addr < 0xFFF; i++ {
+		opcode := uint16(cpu.memory[addr])<<8 | uint16(cpu.memory[addr+1])
+		if opcode>>12 == 0xD {
+			return addr, opcode, true
+		}
+		addr += 2
+	}
+	return 0, 0, false
+}
+
+func spriteByteColor(addr uint16, drawStart uint16, drawLength int) string {
+	switch {
+	case addr >= drawStart && int(addr) < int(drawStart)+drawLength:
+		return "yellow"
+	case int(addr) < len(fontset):
+		return "cyan"
+	}
+	return "white"
+}
+
+func spriteBits(value uint8, on string, off string) string {
+	//Draws a byte as 8 pixels, most significant bit on the left like DRW
+	var bits strings.Builder
+	for bit := 7; bit >= 0; bit-- {
+		if value>>uint(bit)&1 == 1 {
+			bits.WriteString(on)
+		} else {
+			bits.WriteString(off)
+		}
+	}
+	return bits.String()
+}
+
+func spriteLines(start uint16, length int, notes []string) []string {
+	//One byte to a line, pixels two characters wide so the sprite comes out roughly square
+	lines := make([]string, 0, spriteRows)
+	for row := 0; row < spriteRows; row++ {
+		line := ""
+		if row < length && int(start)+row < 0x1000 {
+			addr := start + uint16(row)
+			value := cpu.memory[addr]
+			line = fmt.Sprintf("[%03X](fg:green) %02X [%s](fg:%s)", addr, value,
+				spriteBits(value, "██", "  "), spriteByteColor(addr, start, length))
+		} else if row < len(notes) {
+			line = strings.Repeat(" ", 23)
+		}
+		if row < len(notes) {
+			line += " " + notes[row]
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func spriteStripLines() []string {
+	//Strips of memory side by side, a half block character holds the same pixel of two bytes
+	drawStart, drawLength := uint16(0), 0
+	if _, opcode, ok := nextDraw(); ok {
+		drawStart, drawLength = cpu.index, int(opcode&0xF)
+	}
+
+	lines := make([]string, spriteRows)
+	for strip := 0; strip < spriteStrips; strip++ {
+		for row := 0; row < spriteRows; row++ {
+			top := int(spriteAddr) + (strip*spriteRows+row)*2
+			if top >= 0x1000 {
+				continue
+			}
+			upper := cpu.memory[top]
+			var lower uint8
+			if top+1 < 0x1000 {
+				lower = cpu.memory[top+1]
+			}
+
+			var pixels strings.Builder
+			for bit := 7; bit >= 0; bit-- {
+				switch upper>>uint(bit)&1<<1 | lower>>uint(bit)&1 {
+				case 3:
+					pixels.WriteString("█")
+				case 2:
+					pixels.WriteString("▀")
+				case 1:
+					pixels.WriteString("▄")
+				default:
+					pixels.WriteString(" ")
+				}
+			}
+
+			//The lower byte's colour wins when only it is part of something
+			color := spriteByteColor(uint16(top), drawStart, drawLength)
+			if color == "white" {
+				color = spriteByteColor(uint16(top+1), drawStart, drawLength)
+			}
+			lines[row] += fmt.Sprintf("[%03X](fg:green) [%s](fg:%s) ", top, pixels.String(), color)
+		}
+	}
+	return lines
+}
+
+func updateSpritePane() {
+	var lines []string
+	title := "Sprites - " + spriteMode
+
+	switch spriteMode {
+	case spriteNext:
+		addr, opcode, ok := nextDraw()
+		if !ok {
+			lines = []string{fmt.Sprintf("No DRW in the %d instructions", spriteLookahead), "after the pc"}
+			break
+		}
+		x, y, n := uint8(opcode>>8&0xF), uint8(opcode>>4&0xF), int(opcode&0xF)
+		notes := []string{
+			fmt.Sprintf("[%03X](fg:green) DRW V%X V%X #%X", addr, x, y, n),
+			fmt.Sprintf("at %d,%d", cpu.V[x]%64, cpu.V[y]%32),
+			fmt.Sprintf("from I %03X", cpu.index),
+		}
+		if addr != cpu.pc {
+			notes = append(notes, "if I isn't changed first")
+		}
+		if n == 0 {
+			notes = append(notes, "n is 0, draws nothing")
+		}
+		lines = spriteLines(cpu.index, n, notes)
+	case spriteIndex:
+		lines = spriteLines(cpu.index, spriteLength, []string{fmt.Sprintf("%d bytes at I", spriteLength)})
+	case spriteAddress:
+		lines = spriteLines(spriteAddr, spriteLength, []string{fmt.Sprintf("%d bytes", spriteLength)})
+	case spriteBrowse:
+		lines = spriteStripLines()
+	}
+
+	if spriteGotoActive {
+		title = fmt.Sprintf("Sprites - goto %s_", spriteGoto)
+	}
+	spritePane.Title = title
+	spritePane.Text = strings.Join(lines, "\n")
+}
+
+func moveSprite(bytes int) {
+	spriteAddr = uint16((int(spriteAddr) + bytes) & 0xFFF)
+}
+
+func handleSpriteKey(id string) bool {
+	//m changes what's shown, g goes to an address, i takes the address from I, f browses the font. Returns whether it
+	//was used
+	if spriteGotoActive {
+		switch {
+		case id == "<Enter>":
+			if addr, err := strconv.ParseUint(spriteGoto, 16, 16); err == nil {
+				spriteAddr = uint16(addr) & 0xFFF
+				if spriteMode != spriteBrowse {
+					spriteMode = spriteAddress
+				}
+			}
+			spriteGotoActive = false
+		case id == "<Escape>":
+			spriteGotoActive = false
+		case id == "<Backspace>" && len(spriteGoto) > 0:
+			spriteGoto = spriteGoto[:len(spriteGoto)-1]
+		case isHexDigit(id) && len(spriteGoto) < 3:
+			spriteGoto += strings.ToUpper(id)
+		}
+		return true
+	}
+
+	//A row is a byte when showing one sprite and two bytes when browsing
+	row, page := 1, spriteLength
+	if spriteMode == spriteBrowse {
+		row, page = 2, spriteRows*spriteStrips*2
+	}
+
+	switch id {
+	case "m":
+		for i, mode := range spriteModes {
+			if mode == spriteMode {
+				spriteMode = spriteModes[(i+1)%len(spriteModes)]
+				break
+			}
+		}
+	case "g":
+		spriteGotoActive, spriteGoto = true, ""
+	case "i":
+		spriteAddr = cpu.index
+		if spriteMode != spriteBrowse {
+			spriteMode = spriteAddress
+		}
+	case "f":
+		spriteMode, spriteAddr = spriteBrowse, 0
+	case "+", "=":
+		if spriteLength < 15 {
+			spriteLength++
+		}
+	case "-":
+		if spriteLength > 1 {
+			spriteLength--
+		}
+	case "<Up>":
+		moveSprite(-row)
+	case "<Down>":
+		moveSprite(row)
+	case "<Left>":
+		moveSprite(-1)
+	case "<Right>":
+		moveSprite(1)
+	case "<PageUp>":
+		moveSprite(-page)
+	case "<PageDown>":
+		moveSprite(page)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,227 @@
+package emulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+)
+
+//opcodeFamilies names every kind of instruction by its pattern and mnemonic, the last is anything that isn't one
+var opcodeFamilies = []string{
+	"00E0 CLS", "00EE RET", "1nnn JP", "2nnn CALL", "3xkk SE", "4xkk SNE", "5xy0 SE", "6xkk LD", "7xkk ADD",
+	"8xy0 LD", "8xy1 OR", "8xy2 AND", "8xy3 XOR", "8xy4 ADD", "8xy5 SUB", "8xy6 SHR", "8xy7 SUBN", "8xyE SHL",
+	"9xy0 SNE", "Annn LD I", "Bnnn JP V0", "Cxkk RND", "Dxyn DRW", "Ex9E SKP", "ExA1 SKNP",
+	"Fx07 LD DT", "Fx0A LD K", "Fx15 LD DT", "Fx18 LD ST", "Fx1E ADD I", "Fx29 LD F", "Fx33 LD B", "Fx55 LD [I]",
+	"Fx65 LD [I]", "invalid",
+}
+
+//opcodeStats counts what the rom has been running, from when it started through any resets
+type opcodeStats struct {
+	instructions  uint64
+	families      [35]uint64 //Indexed like opcodeFamilies
+	skipsTaken    uint64
+	skipsNotTaken uint64
+	draws         uint64
+	collisions    uint64 //Draws that set VF
+	keyWaits      uint64 //Times Fx0A had to wait for a key
+	keyWaitCycles uint64 //Instructions spent waiting in Fx0A
+	waiting       bool
+}
+
+var stats opcodeStats
+
+//statsPath is where the JSON asked for with -stats is written on exit
+var statsPath string
+
+//statsPane shows the counts live in the debugger
+var statsPane *widgets.Paragraph
+
+func resetStats() {
+	stats = opcodeStats{}
+}
+
+func opcodeFamily(opcode uint16) int {
+	//Finds an opcode's index in opcodeFamilies, decoding it the same way decodeAndExecute does
+	n := opcode & 0xF
+	kk := opcode & 0xFF
+	switch opcode >> 12 {
+	case 0x0:
+		if kk == 0xE0 {
+			return 0
+		} else if kk == 0xEE {
+			return 1
+		}
+	case 0x8:
+		switch n {
+		case 0x0, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7:
+			return 9 + int(n)
+		case 0xE:
+			return 17
+		}
+	case 0xE:
+		if n == 0xE {
+			return 23
+		} else if n == 0x1 {
+			return 24
+		}
+	case 0xF:
+		for i, low := range []uint16{0x07, 0x0A, 0x15, 0x18, 0x1E, 0x29, 0x33, 0x55, 0x65} {
+			if kk == low {
+				return 25 + i
+			}
+		}
+	default:
+		//1nnn to 7xkk are 2 to 8, 9xy0 to Dxyn are 18 to 22
+		identifier := int(opcode >> 12)
+		if identifier <= 0x7 {
+			return identifier + 1
+		}
+		return identifier + 9
+	}
+	return len(opcodeFamilies) - 1
+}
+
+func (s *opcodeStats) count(c *CPU, pc uint16) {
+	//Called after each instruction has run, pc is where it was
+	family := opcodeFamily(c.opcode)
+	s.instructions++
+	s.families[family]++
+
+	switch opcodeFamilies[family] {
+	case "3xkk SE", "4xkk SNE", "5xy0 SE", "9xy0 SNE", "Ex9E SKP", "ExA1 SKNP":
+		if c.pc == pc+4 {
+			s.skipsTaken++
+		} else {
+			s.skipsNotTaken++
+		}
+	case "Dxyn DRW":
+		s.draws++
+		if c.V[0xF] == 1 {
+			s.collisions++
+		}
+	case "Fx0A LD K":
+		if c.keyWait {
+			s.keyWaitCycles++
+			if !s.waiting {
+				s.keyWaits++
+			}
+		}
+	}
+	s.waiting = c.keyWait
+}
+
+//statsFamily is a row of the instruction mix, sorted busiest first
+type statsFamily struct {
+	name  string
+	count uint64
+}
+
+func (s *opcodeStats) mix() []statsFamily {
+	families := make([]statsFamily, 0)
+	for i, count := range s.families {
+		if count > 0 {
+			families = append(families, statsFamily{opcodeFamilies[i], count})
+		}
+	}
+	sort.Slice(families, func(i, j int) bool {
+		if families[i].count != families[j].count {
+			return families[i].count > families[j].count
+		}
+		return families[i].name < families[j].name
+	})
+	return families
+}
+
+func (s *opcodeStats) percent(count uint64) float64 {
+	if s.instructions == 0 {
+		return 0
+	}
+	return float64(count) * 100 / float64(s.instructions)
+}
+
+func initStatsPane(top int) *widgets.Paragraph {
+	pane := widgets.NewParagraph()
+	pane.Title = "Statistics"
+	pane.BorderStyle.Fg = ui.ColorBlue
+	pane.SetRect(120, top, 148, top+32)
+	return pane
+}
+
+func updateStatsPane() {
+	lines := []string{
+		fmt.Sprintf("[Instructions](fg:yellow) %d", stats.instructions),
+		fmt.Sprintf("[Skips](fg:yellow) %d taken %d not", stats.skipsTaken, stats.skipsNotTaken),
+		fmt.Sprintf("[Draws](fg:yellow) %d", stats.draws),
+		fmt.Sprintf("[Collisions](fg:yellow) %d", stats.collisions),
+		fmt.Sprintf("[Key waits](fg:yellow) %d, %d cycles", stats.keyWaits, stats.keyWaitCycles),
+		"",
+	}
+
+	//As much of the mix as fits beneath
+	rows := statsPane.Inner.Dy() - len(lines)
+	for i, family := range stats.mix() {
+		if i == rows {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("[%-11s](fg:green) %5.1f%% %d", family.name, stats.percent(family.count), family.count))
+	}
+	statsPane.Text = strings.Join(lines, "\n")
+}
+
+//statsReport is how the statistics are written as JSON
+type statsReport struct {
+	Rom           string            `json:"rom"`
+	Title         string            `json:"title,omitempty"`
+	SHA1          string            `json:"sha1"`
+	Instructions  uint64            `json:"instructions"`
+	Families      map[string]uint64 `json:"families"`
+	SkipsTaken    uint64            `json:"skipsTaken"`
+	SkipsNotTaken uint64            `json:"skipsNotTaken"`
+	Draws         uint64            `json:"draws"`
+	Collisions    uint64            `json:"collisions"`
+	KeyWaits      uint64            `json:"keyWaits"`
+	KeyWaitCycles uint64            `json:"keyWaitCycles"`
+}
+
+func writeStats(path string) error {
+	report := statsReport{
+		Rom:           cpu.romPath,
+		SHA1:          cpu.rom.hash,
+		Instructions:  stats.instructions,
+		Families:      make(map[string]uint64),
+		SkipsTaken:    stats.skipsTaken,
+		SkipsNotTaken: stats.skipsNotTaken,
+		Draws:         stats.draws,
+		Collisions:    stats.collisions,
+		KeyWaits:      stats.keyWaits,
+		KeyWaitCycles: stats.keyWaitCycles,
+	}
+	if cpu.rom.known {
+		report.Title = cpu.rom.program.Title
+	}
+	for _, family := range stats.mix() {
+		report.Families[family.name] = family.count
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func saveStats() {
+	//Deferred by RunEmulator like the other captures, so errors show once the terminal is back
+	if statsPath == "" || cpu == nil {
+		return
+	}
+	if err := writeStats(statsPath); err != nil {
+		fmt.Printf("couldn't write statistics: %s\n", err)
+	}
+	statsPath = ""
+}
@@ -0,0 +1,329 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"strings"
+	"time"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+//The terminal frontend draws the display with text, for when there's no window to open, like over ssh
+//halfblock and braille work everywhere, sixel and kitty draw real pixels on terminals that support them
+var terminalMode bool = false
+var terminalStyle string = "halfblock"
+var terminalStyles = []string{"halfblock", "braille", "sixel", "kitty"}
+
+//terminalScreen is the termui widget the display is drawn in, set to be redrawn whenever the display changes
+var terminalScreen *terminalDisplay
+var terminalDirty bool = true
+
+//Terminals don't report keys being let go, so a key counts as held until terminalKeyHold after it was last pressed
+var terminalKeyHold time.Duration = 200 * time.Millisecond
+var terminalKeys = make(map[sdl.Keycode]time.Time)
+
+//terminalKeyNames are termui's names for keys that SDL calls something else
+var terminalKeyNames = map[string]string{
+	"<Enter>":     "Return",
+	"<Backspace>": "Backspace",
+	"<PageUp>":    "PageUp",
+	"<PageDown>":  "PageDown",
+	"<Previous>":  "PageUp",
+	"<Next>":      "PageDown",
+}
+
+//terminalDisplay is a termui widget showing the chip8 display
+type terminalDisplay struct {
+	ui.Block
+}
+
+func newTerminalDisplay() *terminalDisplay {
+	//Halfblocks fit two pixels in a cell and braille eight, graphics take the same space as halfblocks
+	d := &terminalDisplay{Block: *ui.NewBlock()}
+	d.Title = "GoChip-8"
+	d.BorderStyle.Fg = ui.ColorCyan
+	if terminalStyle == "braille" {
+		d.SetRect(0, 0, 32+2, 8+2)
+	} else {
+		d.SetRect(0, 0, 64+2, 16+2)
+	}
+	return d
+}
+
+func (d *terminalDisplay) Draw(buf *ui.Buffer) {
+	d.Block.Draw(buf)
+	if terminalStyle == "sixel" || terminalStyle == "kitty" {
+		//Left empty for the image, which is written straight to the terminal after termui is done
+		return
+	}
+
+	colors := activePalette()
+	frame := composeFrame(&cpu.display, colors)
+	origin := d.Inner.Min
+
+	if terminalStyle == "braille" {
+		//Braille cells are 2x4 dots, lit pixels are drawn in the foreground colour
+		dots := [4][2]rune{{0x01, 0x08}, {0x02, 0x10}, {0x04, 0x20}, {0x40, 0x80}}
+		style := ui.NewStyle(xtermColor(colors.foreground()), xtermColor(colors.background()))
+		for row := 0; row < 8; row++ {
+			for col := 0; col < 32; col++ {
+				char := rune(0x2800)
+				for dy := 0; dy < 4; dy++ {
+					for dx := 0; dx < 2; dx++ {
+						if frame[row*4+dy][col*2+dx] != colors.background() {
+							char |= dots[dy][dx]
+						}
+					}
+				}
+				buf.SetCell(ui.NewCell(char, style), image.Pt(origin.X+col, origin.Y+row))
+			}
+		}
+		return
+	}
+
+	//Halfblocks draw the top pixel in the foreground and the bottom one in the background of each cell
+	for row := 0; row < 16; row++ {
+		for col := 0; col < 64; col++ {
+			style := ui.NewStyle(xtermColor(frame[row*2][col]), xtermColor(frame[row*2+1][col]))
+			buf.SetCell(ui.NewCell('▀', style), image.Pt(origin.X+col, origin.Y+row))
+		}
+	}
+}
+
+func xtermColor(color uint32) ui.Color {
+	//Nearest colour in the xterm 256 colour palette, from its 6x6x6 cube or grey ramp
+	r, g, b := int(color>>16)&0xFF, int(color>>8)&0xFF, int(color)&0xFF
+	cubeLevel := func(c int) int {
+		if c < 48 {
+			return 0
+		} else if c < 115 {
+			return 1
+		}
+		return (c - 35) / 40
+	}
+	cubeValue := func(level int) int {
+		if level == 0 {
+			return 0
+		}
+		return 55 + level*40
+	}
+	distance := func(cr, cg, cb int) int {
+		return (r-cr)*(r-cr) + (g-cg)*(g-cg) + (b-cb)*(b-cb)
+	}
+
+	lr, lg, lb := cubeLevel(r), cubeLevel(g), cubeLevel(b)
+	cube := 16 + 36*lr + 6*lg + lb
+	cubeDistance := distance(cubeValue(lr), cubeValue(lg), cubeValue(lb))
+
+	grey := (r+g+b)/3 - 3
+	greyLevel := 0
+	if grey > 0 {
+		greyLevel = grey / 10
+	}
+	if greyLevel > 23 {
+		greyLevel = 23
+	}
+	greyValue := 8 + greyLevel*10
+	if distance(greyValue, greyValue, greyValue) < cubeDistance {
+		return ui.Color(232 + greyLevel)
+	}
+	return ui.Color(cube)
+}
+
+func writeTerminalGraphics() {
+	//Draws the display as an image over the empty widget, moving the cursor to its corner first
+	inner := terminalScreen.Inner
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "\x1b7\x1b[%d;%dH", inner.Min.Y+1, inner.Min.X+1)
+	if terminalStyle == "kitty" {
+		writeKitty(&out, inner.Dx(), inner.Dy())
+	} else {
+		writeSixel(&out)
+	}
+	out.WriteString("\x1b8")
+	os.Stdout.Write(out.Bytes())
+}
+
+func writeKitty(out *bytes.Buffer, cols int, rows int) {
+	//The kitty graphics protocol takes a png, sent in base64 chunks of at most 4096 bytes and scaled to fit the cells
+	var img bytes.Buffer
+	png.Encode(&img, screenshotImage(&cpu.display, screenshotScale))
+	data := base64.StdEncoding.EncodeToString(img.Bytes())
+
+	for first := true; len(data) > 0 || first; first = false {
+		chunk := data
+		if len(chunk) > 4096 {
+			chunk = chunk[:4096]
+		}
+		data = data[len(chunk):]
+		more := 0
+		if len(data) > 0 {
+			more = 1
+		}
+
+		if first {
+			//The same image and placement ids replace the last frame instead of stacking on top of it
+			fmt.Fprintf(out, "\x1b_Ga=T,f=100,i=1,p=1,q=2,c=%d,r=%d,m=%d;%s\x1b\\", cols, rows, more, chunk)
+		} else {
+			fmt.Fprintf(out, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+}
+
+func writeSixel(out *bytes.Buffer) {
+	//Sixel can't be scaled by the terminal, so the display is drawn at 8 pixels per chip8 pixel, the size of a typical cell
+	img := screenshotImage(&cpu.display, 8)
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	//Register every colour on screen, there are only ever a few without filters
+	index := make(map[uint32]int)
+	colors := make([]uint32, 0)
+	pixels := make([]int, width*height)
+	for i := range pixels {
+		c := uint32(img.Pix[i*4])<<16 | uint32(img.Pix[i*4+1])<<8 | uint32(img.Pix[i*4+2])
+		n, ok := index[c]
+		if !ok {
+			if len(colors) == 256 {
+				n = len(colors) - 1 //Out of colour registers, close enough
+			} else {
+				n = len(colors)
+				index[c] = n
+				colors = append(colors, c)
+			}
+		}
+		pixels[i] = n
+	}
+
+	fmt.Fprintf(out, "\x1bPq\"1;1;%d;%d", width, height)
+	for n, c := range colors {
+		fmt.Fprintf(out, "#%d;2;%d;%d;%d", n, (c>>16&0xFF)*100/255, (c>>8&0xFF)*100/255, (c&0xFF)*100/255)
+	}
+
+	//Each band is 6 rows, drawn once per colour with $ going back to the start of the band
+	for top := 0; top < height; top += 6 {
+		for n := range colors {
+			var band strings.Builder
+			used := false
+			for x := 0; x < width; x++ {
+				bits := 0
+				for dy := 0; dy < 6 && top+dy < height; dy++ {
+					if pixels[(top+dy)*width+x] == n {
+						bits |= 1 << uint(dy)
+					}
+				}
+				used = used || bits != 0
+				band.WriteByte(byte(63 + bits))
+			}
+			if used {
+				fmt.Fprintf(out, "#%d%s$", n, band.String())
+			}
+		}
+		out.WriteString("-")
+	}
+	out.WriteString("\x1b\\")
+}
+
+func validTerminalStyle(style string) bool {
+	for _, s := range terminalStyles {
+		if s == style {
+			return true
+		}
+	}
+	return false
+}
+
+func terminalKey(id string) (sdl.Keycode, bool) {
+	//Turns termui's name for a key into the SDL keycode the keymaps and hotkeys are built from
+	name := id
+	if special, ok := terminalKeyNames[id]; ok {
+		name = special
+	} else if strings.HasPrefix(id, "<") && strings.HasSuffix(id, ">") {
+		name = strings.Trim(id, "<>")
+	}
+	key := sdl.GetKeyFromName(name)
+	return key, key != sdl.K_UNKNOWN
+}
+
+func handleTerminalEvent(e ui.Event) {
+	switch e.Type {
+	case ui.KeyboardEvent:
+		if e.ID == "<C-c>" {
+			running = false
+			return
+		}
+		if handleDebuggerKey(e.ID) {
+			return
+		}
+		key, ok := terminalKey(e.ID)
+		if !ok {
+			return
+		}
+		//Keys only reach the keypad while the game has focus over the debugger panes
+		toKeypad := !debuggerShown || debuggerFocus == focusGame
+		action, isHotkey := hotkeys[key]
+		if toKeypad {
+			action, isHotkey = hotkeyAction(key)
+		}
+		if isHotkey {
+			performAction(action)
+			return
+		}
+		if toKeypad {
+			cpu.handleKeypress(key, true)
+			terminalKeys[key] = time.Now()
+		}
+	case ui.ResizeEvent:
+		ui.Clear()
+		terminalDirty = true
+	}
+}
+
+func releaseTerminalKeys() {
+	//Lets go of keys that haven't been pressed again, or repeated by the terminal, for a while
+	for key, pressed := range terminalKeys {
+		if time.Since(pressed) >= terminalKeyHold {
+			cpu.handleKeypress(key, false)
+			delete(terminalKeys, key)
+		}
+	}
+}
+
+func renderTerminal() {
+	ui.Render(terminalScreen)
+	renderDebugger()
+	if heatmapShown && !debuggerShown {
+		ui.Render(heatmapPane)
+	}
+	if terminalDirty && (terminalStyle == "sixel" || terminalStyle == "kitty") {
+		writeTerminalGraphics()
+	}
+	terminalDirty = false
+}
+
+func runTerminal() {
+	//The terminal frontend's main loop, runs the emulation at 100hz like the window does
+	events := termuiEvents()
+	ticker := time.NewTicker(time.Second / 100)
+	defer ticker.Stop()
+
+	for running {
+		select {
+		case e := <-events:
+			handleTerminalEvent(e)
+		case <-ticker.C:
+			releaseTerminalKeys()
+			checkRomChanged()
+			checkInterrupted()
+			if stepMode == -1 {
+				emulateTick()
+			}
+			renderTerminal()
+		}
+	}
+}
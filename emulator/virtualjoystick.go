@@ -0,0 +1,62 @@
+//go:build virtualjoystick
+
+package emulator
+
+//Virtual joysticks for the controller test, which is built with -tags virtualjoystick as it needs SDL 2.0.14 or later
+
+//#cgo windows LDFLAGS: -lSDL2
+//#cgo linux freebsd darwin openbsd pkg-config: sdl2
+//#include <SDL.h>
+import "C"
+
+import "fmt"
+
+//virtualJoystick is a joystick SDL treats as plugged in, with buttons numbered the way SDL numbers controller buttons
+type virtualJoystick struct {
+	index int
+	joy   *C.SDL_Joystick
+}
+
+func attachVirtualJoystick(axes int, buttons int) (*virtualJoystick, error) {
+	index := C.SDL_JoystickAttachVirtual(C.SDL_JOYSTICK_TYPE_GAMECONTROLLER, C.int(axes), C.int(buttons), 0)
+	if index < 0 {
+		return nil, fmt.Errorf("couldn't attach a virtual joystick: %s", C.GoString(C.SDL_GetError()))
+	}
+	//Opening it here as well as in handleControllerEvent is counted by SDL, so both get the same joystick
+	joy := C.SDL_JoystickOpen(index)
+	if joy == nil {
+		C.SDL_JoystickDetachVirtual(index)
+		return nil, fmt.Errorf("couldn't open the virtual joystick: %s", C.GoString(C.SDL_GetError()))
+	}
+	return &virtualJoystick{int(index), joy}, nil
+}
+
+func (v *virtualJoystick) setButton(button int, pressed bool) error {
+	state := C.Uint8(C.SDL_RELEASED)
+	if pressed {
+		state = C.SDL_PRESSED
+	}
+	if C.SDL_JoystickSetVirtualButton(v.joy, C.int(button), state) != 0 {
+		return fmt.Errorf("couldn't set button %d: %s", button, C.GoString(C.SDL_GetError()))
+	}
+	return nil
+}
+
+func (v *virtualJoystick) setAxis(axis int, value int16) error {
+	if C.SDL_JoystickSetVirtualAxis(v.joy, C.int(axis), C.Sint16(value)) != 0 {
+		return fmt.Errorf("couldn't set axis %d: %s", axis, C.GoString(C.SDL_GetError()))
+	}
+	return nil
+}
+
+func (v *virtualJoystick) detach() {
+	//Device indexes move down as joysticks go, so the one to detach is found by its instance id
+	id := C.SDL_JoystickInstanceID(v.joy)
+	for i := C.int(0); i < C.SDL_NumJoysticks(); i++ {
+		if C.SDL_JoystickGetDeviceInstanceID(i) == id {
+			C.SDL_JoystickDetachVirtual(i)
+			break
+		}
+	}
+	C.SDL_JoystickClose(v.joy)
+}
@@ -0,0 +1,79 @@
+package emulator
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+//romChanged is signalled by the watcher once the rom file has changed on disk, and watchErrors when watching goes wrong
+var romChanged = make(chan bool, 1)
+var watchErrors = make(chan error, 1)
+
+//romWatcher is replaced whenever a different rom is started
+var romWatcher *fsnotify.Watcher
+
+//Editors and assemblers often write a file in several steps, so wait for things to settle before reloading
+var watchSettle = 100 * time.Millisecond
+
+func watchRom(filePath string) error {
+	//Watches the directory holding the rom rather than the rom itself, as saving by renaming would lose the watch
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(filePath)); err != nil {
+		watcher.Close()
+		return err
+	}
+	if romWatcher != nil {
+		romWatcher.Close()
+	}
+	romWatcher = watcher
+
+	go func() {
+		settle := time.NewTimer(watchSettle)
+		settle.Stop()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == filepath.Clean(filePath) && event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+					settle.Reset(watchSettle)
+				}
+			case <-settle.C:
+				//Never block, a reload that's already pending covers this change too
+				select {
+				case romChanged <- true:
+				default:
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				select {
+				case watchErrors <- err:
+				default:
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func checkRomChanged() {
+	//Reloads the rom if the watcher saw it change, called from the main loop so the cpu is only touched there
+	select {
+	case <-romChanged:
+		reloadCPU()
+		quickUpdateDebug()
+	case err := <-watchErrors:
+		appendInstruction(&instructionSlice, fmt.Sprintf("[watch error: %s](fg:red)\n", err))
+	default:
+	}
+}
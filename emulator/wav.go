@@ -0,0 +1,63 @@
+package emulator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+func writeWav(fileName string, samples []int16, sampleRate int) error {
+	//Writes 16 bit mono pcm samples to a wav file
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dataSize := uint32(len(samples) * 2)
+	header := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'}, 36 + dataSize, [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16),
+		uint16(1),              //pcm
+		uint16(1),              //mono
+		uint32(sampleRate),     //samples per second
+		uint32(sampleRate * 2), //bytes per second
+		uint16(2),              //bytes per sample
+		uint16(16),             //bits per sample
+		[4]byte{'d', 'a', 't', 'a'}, dataSize,
+	}
+	for _, field := range header {
+		if err := binary.Write(file, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+	return binary.Write(file, binary.LittleEndian, samples)
+}
+
+//wavCapture renders the buzzer a frame at a time in step with emulation, so what's written doesn't depend on the speaker
+type wavCapture struct {
+	path    string
+	tone    tone
+	samples []int16
+}
+
+//audioOut is the capture asked for with --audio-out, it's written when the emulator closes
+var audioOut *wavCapture
+
+func (w *wavCapture) addFrame(on bool) {
+	w.samples = append(w.samples, w.tone.frame(on)...)
+}
+
+func (w *wavCapture) save() error {
+	return writeWav(w.path, w.samples, audioSampleRate)
+}
+
+func saveAudioOut() {
+	if audioOut == nil {
+		return
+	}
+	if err := audioOut.save(); err != nil {
+		fmt.Printf("couldn't write audio: %s\n", err)
+	}
+	audioOut = nil
+}
@@ -6,47 +6,39 @@ import (
 	"github.com/gizak/termui/v3/widgets"
 	"github.com/veandco/go-sdl2/sdl"
 
-	"github.com/faiface/beep"
-	"github.com/faiface/beep/mp3"
-	"github.com/faiface/beep/speaker"
-
-	"os"
 	"strings"
 	"time"
-	"strconv"
 )
 
-//Color vars
-var white uint32 = 0x2C2F33
-var black uint32 = 0x7289DA
-var perimColor uint32 = 0x7289DA
-
-//Window size var
+//Window size vars, the multiplier and border can be changed in the config and the window resized while running
 var multiplier int32 = 15
 var perim int32 = 6
 
-var screenWidth int32 = (64*multiplier + (perim * 2))
-var screenHeight int32 = (32*multiplier + (perim * 2))
+var screenWidth int32
+var screenHeight int32
 
-var stepMode int = -1 //Used to check if instruction-by-instruction mode is toggled
-var executing int = 1 //Used to pause cpu
+var stepMode int = -1    //Used to check if instruction-by-instruction mode is toggled
+var resumed bool = false //Set when stepmode is left, so the instruction it stopped on runs before breaking again
+var breakMessage string  //Why the emulation stopped, shown in the title when there's no debugger to show it
+var executing int = 1    //Used to pause cpu
 var running bool = true
 
-var s,_ = strconv.ParseInt(os.Args[2],10,64)
-var speed int = int(s)
+var speed int = 600 //Instructions executed per second
 
 var timerCounter int = 0 //increment by 1 every 0.1s, is used to decrement timers at 60hz
 var start time.Time = time.Now()
 
-//Initialise vm,window,surface and renderer
-var window, surface, renderer = initWindow()
-var cpu = initCPU(fmt.Sprintf("%s",os.Args[1]))
+//vm,window,surface and renderer, initialised by RunEmulator
+var window *sdl.Window
+var surface *sdl.Surface
+var renderer *sdl.Renderer
+var cpu *CPU
 
 //Instruction slice thats rendered on the debug window
 var instructionSlice = make([]string, 14)
 
-//Setup terminal debugging windows
-var instructionDebug, cpuVDebug, cpuGDebug, cpuStack, debugMode = initDebugging()
+//Terminal debugging windows
+var instructionDebug, cpuVDebug, cpuGDebug, cpuStack, debugMode *widgets.Paragraph
 
 func checkErr(err error, desc string) {
 	if err != nil {
@@ -61,19 +53,24 @@ func setRenderColor(renderer *sdl.Renderer, color uint32) {
 func fullCycle() { //If stepmode, then show debug every cycle
 	//Get data from execution of a cpu cycle, such as instruction executed at a given memory location
 	memoryLocation, instructionExecuted, drawBool := cpu.cycle()
-	memoryAndInstruction := fmt.Sprintf("[0x%s](fg:green)   ---   [%s](fg:yellow,)\n", memoryLocation, instructionExecuted)
+	if debuggerShown {
+		memoryAndInstruction := fmt.Sprintf("[0x%s](fg:green)   ---   [%s](fg:yellow,)\n", memoryLocation, instructionExecuted)
 
-	//Appends instruction to the instructionSlice to display in the debugging panel
-	appendInstruction(&instructionSlice, memoryAndInstruction)
+		//Appends instruction to the instructionSlice to display in the debugging panel
+		appendInstruction(&instructionSlice, memoryAndInstruction)
+	}
 
-	//Draw to screen if cpu cycle updated screen
-	if drawBool {
-		drawFromArray(window, surface, renderer, &cpu.display)
+	//Draw to screen if cpu cycle updated screen, other presentation modes wait for the end of the frame. Stepping shows
+	//every draw but doesn't add it to the frame history, which only moves on once a 60hz frame
+	if drawBool && stepMode == 1 {
+		redraw()
+	} else if drawBool && presentMode == presentImmediate {
+		captureFrame(&cpu.display)
+		redraw()
 	}
 
 	//Set debug text from cpu
-	instructionDebug.Text = "\n" + strings.Join(instructionSlice[:], "\n")
-	cpuVDebug.Text, cpuGDebug.Text, debugMode.Text, cpuStack.Text = getDebugInformation(*cpu, executing, stepMode)
+	refreshDebugger()
 }
 
 func initWindow() (*sdl.Window, *sdl.Surface, *sdl.Renderer) {
@@ -81,13 +78,15 @@ func initWindow() (*sdl.Window, *sdl.Surface, *sdl.Renderer) {
 	err := sdl.Init(sdl.INIT_EVERYTHING)
 	checkErr(err, "SDL initialisation error")
 
-	//Initialise termui
-	err = ui.Init()
-	checkErr(err, "Failed to intialise termui")
-
 	//Create window
+	screenWidth = 64*multiplier + (perim * 2)
+	screenHeight = 32*multiplier + (perim * 2)
+	var flags uint32 = sdl.WINDOW_SHOWN | sdl.WINDOW_RESIZABLE
+	if settings.Fullscreen {
+		flags |= sdl.WINDOW_FULLSCREEN_DESKTOP
+	}
 	window, err := sdl.CreateWindow("GoChip-8", sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED,
-		screenWidth, screenHeight, sdl.WINDOW_SHOWN)
+		screenWidth, screenHeight+keypadHeight(), flags)
 	checkErr(err, "Window creation error")
 
 	//Get surface
@@ -98,50 +97,36 @@ func initWindow() (*sdl.Window, *sdl.Surface, *sdl.Renderer) {
 	renderer, err := sdl.CreateRenderer(window, -1, sdl.RENDERER_ACCELERATED)
 	checkErr(err, "renderer creation error")
 
-	//border2 := sdl.Rect{0,0,width+(perim*2),height+(perim*2)}
-	//renderer.FillRect(&border2)
 	return window, surface, renderer
 }
 
-func initBeep() (beep.StreamSeekCloser, *beep.Ctrl) {
-	file, err := os.Open("beep.mp3")
-	checkErr(err, "couldn't find beep.mp3")
-
-	streamer, format, err := mp3.Decode(file)
-	checkErr(err, "couldn't decode beep.mp3")
-
-	speaker.Init(format.SampleRate, format.SampleRate.N(time.Second/10))
-	ctrl := &beep.Ctrl{Streamer: beep.Loop(-1, streamer)}
-	return streamer, ctrl
-}
-
-func initDebugging() (*widgets.Paragraph, *widgets.Paragraph, *widgets.Paragraph, *widgets.Paragraph, *widgets.Paragraph) {
-	//Initialise termui components
+func initDebugging(top int) (*widgets.Paragraph, *widgets.Paragraph, *widgets.Paragraph, *widgets.Paragraph, *widgets.Paragraph) {
+	//Initialise termui components, top leaves room above them for the terminal frontend's display
 
 	instructionDebug := widgets.NewParagraph()
 	instructionDebug.Title = "Instructions"
 	instructionDebug.BorderStyle.Fg = ui.ColorBlue
-	instructionDebug.SetRect(1, 0, 30, 30)
+	instructionDebug.SetRect(1, top, 30, top+30)
 
 	cpuVRegisters := widgets.NewParagraph()
 	cpuVRegisters.Title = "V Registers"
 	cpuVRegisters.BorderStyle.Fg = ui.ColorRed
-	cpuVRegisters.SetRect(31, 0, 60, 10)
+	cpuVRegisters.SetRect(31, top, 60, top+10)
 
 	cpuOtherRegisters := widgets.NewParagraph()
 	cpuOtherRegisters.Title = "General Registers"
 	cpuOtherRegisters.BorderStyle.Fg = ui.ColorMagenta
-	cpuOtherRegisters.SetRect(61, 0, 92, 30)
+	cpuOtherRegisters.SetRect(61, top, 92, top+30)
 
 	cpuStack := widgets.NewParagraph()
 	cpuStack.Title = "Stack"
 	cpuStack.BorderStyle.Fg = ui.ColorRed
-	cpuStack.SetRect(31, 10, 60, 30)
+	cpuStack.SetRect(31, top+10, 60, top+30)
 
 	debugMode := widgets.NewParagraph()
 	debugMode.Title = "Debug modes"
 	debugMode.BorderStyle.Fg = ui.ColorWhite
-	debugMode.SetRect(93, 0, 119, 30)
+	debugMode.SetRect(93, top, 119, top+30)
 
 	return instructionDebug, cpuVRegisters, cpuOtherRegisters, cpuStack, debugMode
 }
@@ -150,27 +135,25 @@ func drawFromArray(window *sdl.Window, surface *sdl.Surface, renderer *sdl.Rende
 	renderer.Clear()
 
 	//Called at 60fps or something of that sorts
-	var color uint32
-
-	//Draw borders onto screen
-	setRenderColor(renderer, perimColor)
-	border1 := sdl.Rect{0, 0, screenWidth, screenHeight}
-	renderer.FillRect(&border1)
-
-	//Loop through 64x32 space and draw rects
-	//Color determined by value held by the videoArr
-
-	for x := 0; x < 64; x++ {
-		for y := 0; y < 32; y++ {
-			if (*videoArr)[y][x] == 1 {
-				color = black
-			} else {
-				color = white
-			}
-			setRenderColor(renderer, color)
-			pixel := sdl.Rect{int32(x)*multiplier + perim, int32(y)*multiplier + perim, multiplier, multiplier}
-			renderer.FillRect(&pixel)
-		}
+	colors := activePalette()
+
+	//Fill the window with the border colour and draw the display over the middle of it
+	setRenderColor(renderer, colors.border)
+	renderer.FillRect(nil)
+
+	if heatmapShown {
+		uploadTexture(heatmapBuffer())
+		heatmap := heatmapRect()
+		renderer.Copy(displayTexture, nil, &heatmap)
+	} else {
+		frame := composeFrame(videoArr, colors)
+		updateDisplayTexture(&frame)
+		display := displayRect()
+		renderer.Copy(displayTexture, nil, &display)
+	}
+
+	if keypadShown {
+		drawKeypad(renderer)
 	}
 	renderer.Present()
 }
@@ -200,6 +183,23 @@ func getDebugInformation(c CPU, running int, stepping int) (string, string, stri
 	modes = append(modes, fmt.Sprintf(" [Running](fg:yellow): %t", running == 1))
 	modes = append(modes, fmt.Sprintf(" [Stepmode](fg:yellow): %t", stepping == 1))
 	modes = append(modes, fmt.Sprintf(" [Speed](fg:yellow): %d", speed))
+	modes = append(modes, fmt.Sprintf(" [Palette](fg:yellow): %s", activePalette().name))
+	modes = append(modes, fmt.Sprintf(" [Present](fg:yellow): %s", presentMode))
+	modes = append(modes, fmt.Sprintf(" [Filter](fg:yellow): %s", activeFilter().name))
+	modes = append(modes, fmt.Sprintf(" [Muted](fg:yellow): %t", muted))
+	if recording != nil {
+		modes = append(modes, fmt.Sprintf(" [Recording](fg:yellow): %s", recording.path))
+	}
+	if len(breakpoints) > 0 {
+		modes = append(modes, fmt.Sprintf(" [Breakpoints](fg:yellow): %s", formatBreakpoints()))
+	}
+	if len(watchpoints) > 0 {
+		modes = append(modes, fmt.Sprintf(" [Watchpoints](fg:yellow): %s", formatWatchpoints()))
+	}
+	if c.rom.known {
+		modes = append(modes, fmt.Sprintf(" [Rom](fg:yellow): %s", c.rom.program.Title))
+		modes = append(modes, fmt.Sprintf(" [Platform](fg:yellow): %s", c.rom.platform.ID))
+	}
 
 	//Return formatted cpu stack data
 	cpuStackFormatted := make([]string, 0)
@@ -218,150 +218,228 @@ func getDebugInformation(c CPU, running int, stepping int) (string, string, stri
 }
 
 func runWindow() {
-	//Init beep and related stuff
-	streamer, ctrl := initBeep()
-	speaker.Lock()
-	ctrl.Paused = true
-	speaker.Unlock()
-	speaker.Play(ctrl)
-
-	//draw the initial screen
-	drawFromArray(window, surface, renderer, &cpu.display)
-
-	//Destroy window, quit SDL subsystems,termui and beep
-	defer sdl.Quit()
-	defer window.Destroy()
-	defer renderer.Destroy()
-	defer ui.Close()
-	defer streamer.Close()
-
+	//The buzzer only sounds for frames that are run, so it's quiet while paused or stepping
 	for running {
 		if stepMode == 1 {
-			//Prevent sound when stepping
-			speaker.Lock()
-			ctrl.Paused = true
-			speaker.Unlock()
-			
 			//Allow for step by step instruction execution
+			//It's also left by the debugger's quit, an interrupt or the terminal hotkeys, which don't come through SDL
 			pause := true
-			for pause {
-				ui.Render(instructionDebug, cpuVDebug, cpuGDebug, cpuStack, debugMode) //Draw debug menu
+			for pause && running && stepMode == 1 {
+				renderDebugger() //Draw debug menu
+				pollDebugger()
+				checkRomChanged()
+				checkInterrupted()
 				for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
-					switch e := event.(type) {
-					case *sdl.KeyboardEvent:
-						if e.Type == sdl.KEYDOWN {
-							//Toggle stepmode off; kinda ugly but eh
-							switch e.Keysym.Scancode {
-							case 12:
-								stepMode *= -1
-								quickUpdateDebug()
-								pause = false
-							case 19:
-								executing *= -1
-								quickUpdateDebug()
-							case 18: //press O to step
-								fullCycle()
-								pause = false
-							case 47: // [ decreases speed of emulation
-								speed -= 10
-								limitSpeed(&speed)
-								quickUpdateDebug()
-							case 48: // ] increases speed of emulation
-								speed += 10
-								limitSpeed(&speed)
-								quickUpdateDebug()
-							}
-						}
-					case *sdl.QuitEvent:
+					//Leave the pause loop once stepped, when stepmode is toggled off or on quit
+					action := handleEvent(event)
+					if action == actionStep || action == actionStepOnce || !running {
 						pause = false
-						running = false
-						break
 					}
 				}
+				time.Sleep(time.Second / 100)
 			}
 		} else {
 			if time.Since(start) >= (time.Second)/100 {
 				start = time.Now()
 
 				//Draw debug console at 100hz
-				ui.Render(instructionDebug, cpuVDebug, cpuGDebug, cpuStack, debugMode)
-
-				//Play sound if ST > 0
-				if cpu.soundTimer > 0 {
-					speaker.Lock()
-					ctrl.Paused = false
-					speaker.Unlock()
-				} else {
-					speaker.Lock()
-					ctrl.Paused = true
-					speaker.Unlock()
+				renderDebugger()
+				pollDebugger()
+				checkRomChanged()
+				checkInterrupted()
+
+				//Keep the keypad highlights up to date
+				if keypadShown {
+					drawFromArray(window, surface, renderer, &cpu.display)
 				}
 
-				if executing == 1 && stepMode == -1 {
-					//Decrease timers at 60hz
-					timerCounter++
-					if (timerCounter % 100) < 60 {
-						if cpu.delayTimer > 0 {
-							cpu.delayTimer--
-						}
-						if cpu.soundTimer > 0 {
-							cpu.soundTimer--
-						}
-					} else if timerCounter == 100 {
-						timerCounter = 0
-					}
-
-					for i := 0; i < speed/100; i++ {
-						//execute a certain number of cycles per 1/100th of a second
-						fullCycle()
-					}
-				} else if executing == -1 {
-					//Prevent sound when paused
-					speaker.Lock()
-					ctrl.Paused = true
-					speaker.Unlock()
-				}
+				emulateTick()
 			}
 			//Handle keyboard inputs
 			for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
-				switch e := event.(type) {
-				case *sdl.KeyboardEvent:
-					if e.Type == sdl.KEYDOWN {
-						//fmt.Println(e.Keysym.Scancode)
-						switch e.Keysym.Scancode {
-						case 12:
-							//TODO: also this as a way to run the cpu as a command line thing
-							//Toggle stepmode with I
-							stepMode *= -1
-							quickUpdateDebug()
-						case 19:
-							//Toggle pause with P
-							executing *= -1
-							quickUpdateDebug()
-						case 47: // [ decreases speed of emulation
-							speed -= 10
-							limitSpeed(&speed)
-							quickUpdateDebug()
-						case 48: // ] increases speed of emulation
-							speed += 10
-							limitSpeed(&speed)
-							quickUpdateDebug()
-						default:
-							cpu.handleKeypress(e.Keysym.Scancode, true)
-						}
-					} else if e.Type == sdl.KEYUP {
-						cpu.handleKeypress(e.Keysym.Scancode, false)
-					}
-				case *sdl.QuitEvent:
-					running = false
-					break
-				}
+				handleEvent(event)
 			}
 		}
 	}
 }
 
+func emulateTick() {
+	//Runs 1/100th of a second of emulation, called at 100hz by the frontends
+	if executing == 1 && stepMode == -1 {
+		//Decrease timers at 60hz, spread evenly over the 100 ticks a second so the buzzer gets a steady stream of frames
+		timerCounter++
+		frame := timerCounter*60/100 != (timerCounter-1)*60/100
+		if frame {
+			//A DRW waiting on the vblank quirk holds the cpu until the next 60hz frame, not the next tick
+			cpu.vblankWait = false
+			if cpu.delayTimer > 0 {
+				cpu.delayTimer--
+			}
+			if cpu.soundTimer > 0 {
+				cpu.soundTimer--
+			}
+		}
+		if timerCounter == 100 {
+			timerCounter = 0
+		}
+
+		watchpointHit = false
+		for i := 0; i < speed/100 && !cpu.vblankWait; i++ {
+			//Drop into stepmode before the instruction on a breakpoint runs, unless running has just resumed from it
+			if breakpoints[cpu.pc] && !resumed {
+				breakTo(fmt.Sprintf("breakpoint at %03X", cpu.pc))
+				break
+			}
+			resumed = false
+
+			//execute a certain number of cycles per 1/100th of a second
+			fullCycle()
+
+			//and after an instruction that wrote to a watchpoint
+			if watchpointHit {
+				watchpointHit = false
+				breakTo(fmt.Sprintf("write to watchpoint %03X", watchpointAddr))
+				break
+			}
+		}
+
+		if frame {
+			presentDisplay()
+			if err := finishFrame(); err != nil {
+				appendInstruction(&instructionSlice, fmt.Sprintf("[%s](fg:red)\n", err))
+			}
+		}
+	}
+}
+
+func handleEvent(event sdl.Event) string {
+	//Handles a single SDL event, returning the hotkey action performed if there was one
+	switch e := event.(type) {
+	case *sdl.KeyboardEvent:
+		return handleKeyboardEvent(e)
+	case *sdl.ControllerDeviceEvent, *sdl.ControllerButtonEvent, *sdl.ControllerAxisEvent:
+		handleControllerEvent(e)
+	case *sdl.MouseButtonEvent, *sdl.TouchFingerEvent:
+		handleKeypadEvent(e)
+	case *sdl.WindowEvent:
+		//Redraw to fit the new size, or when the window has been uncovered
+		if e.Event == sdl.WINDOWEVENT_SIZE_CHANGED || e.Event == sdl.WINDOWEVENT_EXPOSED {
+			drawFromArray(window, surface, renderer, &cpu.display)
+		}
+	case *sdl.DropEvent:
+		//Roms dropped onto the window replace the one running
+		if e.Type == sdl.DROPFILE {
+			switchRom(e.File)
+		}
+	case *sdl.QuitEvent:
+		running = false
+	}
+	return ""
+}
+
+func handleKeyboardEvent(e *sdl.KeyboardEvent) string {
+	//Performs the action bound to a hotkey, otherwise passes the key on to the keypad. Returns the action performed
+	action, isHotkey := hotkeyAction(e.Keysym.Sym)
+	if !isHotkey {
+		cpu.handleKeypress(e.Keysym.Sym, e.Type == sdl.KEYDOWN)
+		return ""
+	}
+	if e.Type != sdl.KEYDOWN {
+		return ""
+	}
+
+	performAction(action)
+	return action
+}
+
+func performAction(action string) {
+	//Performs a hotkey action for any frontend, the ones that need a window do nothing in the terminal
+	switch action {
+	case actionStep:
+		//Toggle stepmode
+		stepMode *= -1
+		resumed = stepMode == -1
+		if resumed && breakMessage != "" {
+			breakMessage = ""
+			setWindowTitle()
+		}
+	case actionStepOnce:
+		//Step one instruction, only in stepmode
+		if stepMode == 1 {
+			fullCycle()
+		}
+	case actionPause:
+		executing *= -1
+	case actionSpeedDown:
+		speed -= 10
+		limitSpeed(&speed)
+	case actionSpeedUp:
+		speed += 10
+		limitSpeed(&speed)
+	case actionReset:
+		resetCPU()
+	case actionReload:
+		reloadCPU()
+	case actionBreakpoint:
+		toggleBreakpoint(cpu.pc)
+	case actionScreenshot:
+		saveScreenshot(&cpu.display)
+	case actionKeypad:
+		if !terminalMode {
+			toggleKeypad()
+		}
+	case actionPalette:
+		cyclePalette()
+		redraw()
+	case actionPresent:
+		cyclePresentMode()
+		redraw()
+	case actionFilter:
+		cycleFilter()
+		redraw()
+	case actionRecord:
+		toggleRecording()
+	case actionDebugger:
+		toggleDebugger()
+	case actionMute:
+		toggleMute()
+	case actionHeatmap:
+		toggleHeatmap()
+	case actionStepBack:
+		stepBack()
+	case actionReverse:
+		reverseToBreak()
+	case actionFullscreen:
+		if !terminalMode {
+			toggleFullscreen()
+		}
+	case actionLauncher:
+		if terminalMode {
+			break
+		}
+		if romPath, ok := runLauncher(); ok {
+			switchRom(romPath)
+		} else {
+			redraw()
+		}
+	}
+	quickUpdateDebug()
+}
+
+func breakTo(reason string) {
+	//Drops into stepmode, with the reason in the title if the debugger's hidden or the game would just look frozen
+	stepMode = 1
+	quickUpdateDebug()
+	if !debuggerShown {
+		breakMessage = reason
+		setWindowTitle()
+	}
+}
+
 func quickUpdateDebug() {
+	if !debuggerShown {
+		return
+	}
 	_, _, debugMode.Text, _ = getDebugInformation(*cpu, executing, stepMode)
 	ui.Render(debugMode)
 }